@@ -0,0 +1,45 @@
+-- =============================================================================
+-- Migration: add_outbox_retries
+-- Purpose:   Track delivery attempts on wa_bridge.outgoing_messages so the Go
+--            bridge can retry transient send failures (WhatsApp disconnected,
+--            timeouts) with exponential backoff instead of marking the row
+--            'failed' on the first error.
+--
+--            A row being retried stays in status 'pending' with
+--            next_attempt_at set in the future; the bridge's outbox scheduler
+--            picks it up once it is due. error_message always holds the most
+--            recent error so the frontend can show why a message is delayed.
+--
+--            Depends on: 20260219000001_tables.sql, 20260219000002_views.sql
+-- =============================================================================
+
+-- -----------------------------------------------------------------------------
+-- 1. Columns
+-- -----------------------------------------------------------------------------
+
+ALTER TABLE wa_bridge.outgoing_messages
+    ADD COLUMN IF NOT EXISTS attempts        integer     NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS next_attempt_at timestamptz,
+    ADD COLUMN IF NOT EXISTS last_attempt_at timestamptz;
+
+-- -----------------------------------------------------------------------------
+-- 2. Index
+--    The outbox scheduler repeatedly asks for the earliest due retry; keep that
+--    lookup cheap by indexing only pending rows.
+-- -----------------------------------------------------------------------------
+
+CREATE INDEX IF NOT EXISTS idx_outgoing_messages_next_attempt
+    ON wa_bridge.outgoing_messages (next_attempt_at)
+    WHERE status = 'pending';
+
+-- -----------------------------------------------------------------------------
+-- 3. Recreate public.outgoing_messages so the new columns are visible
+--    SELECT * is expanded when a view is created, so new columns only appear
+--    after the view is replaced.
+-- -----------------------------------------------------------------------------
+
+CREATE OR REPLACE VIEW public.outgoing_messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.outgoing_messages;
+
+GRANT SELECT, INSERT ON public.outgoing_messages TO authenticated;
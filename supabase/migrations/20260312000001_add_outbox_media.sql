@@ -0,0 +1,46 @@
+-- =============================================================================
+-- Migration: add_outbox_media
+-- Purpose:   Allow wa_bridge.outgoing_messages rows to carry a media attachment
+--            stored in Supabase Storage. The Go bridge downloads the object,
+--            uploads it to WhatsApp, and sends the matching image / video /
+--            audio / document message.
+--
+--            For media rows `content` is the optional caption, so it becomes
+--            nullable; every row must still carry either content or media.
+--
+--            media_bucket defaults to 'wa-media'. Objects from other buckets
+--            are copied into wa-media after sending so the sent row renders in
+--            the chat view like any received media.
+--
+--            Depends on: 20260219000001_tables.sql,
+--                        20260311000001_add_outbox_retries.sql
+-- =============================================================================
+
+-- -----------------------------------------------------------------------------
+-- 1. Columns
+-- -----------------------------------------------------------------------------
+
+ALTER TABLE wa_bridge.outgoing_messages
+    ALTER COLUMN content DROP NOT NULL;
+
+ALTER TABLE wa_bridge.outgoing_messages
+    ADD COLUMN IF NOT EXISTS media_path      text,
+    ADD COLUMN IF NOT EXISTS media_bucket    text NOT NULL DEFAULT 'wa-media',
+    ADD COLUMN IF NOT EXISTS media_type      text
+        CHECK (media_type IN ('image', 'video', 'audio', 'document')),
+    ADD COLUMN IF NOT EXISTS media_mime_type text,
+    ADD COLUMN IF NOT EXISTS media_filename  text;
+
+ALTER TABLE wa_bridge.outgoing_messages
+    ADD CONSTRAINT outgoing_messages_content_or_media
+    CHECK (content IS NOT NULL OR media_path IS NOT NULL);
+
+-- -----------------------------------------------------------------------------
+-- 2. Recreate public.outgoing_messages so the new columns are visible
+-- -----------------------------------------------------------------------------
+
+CREATE OR REPLACE VIEW public.outgoing_messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.outgoing_messages;
+
+GRANT SELECT, INSERT ON public.outgoing_messages TO authenticated;
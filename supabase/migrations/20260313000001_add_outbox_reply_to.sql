@@ -0,0 +1,39 @@
+-- =============================================================================
+-- Migration: add_outbox_reply_to
+-- Purpose:   Let outgoing messages quote an earlier message in the same chat.
+--            When reply_to_message_id is set the Go bridge looks the target up
+--            in wa_bridge.messages, sends the reply with a WhatsApp quote, and
+--            stores reply_to_message_id on the inserted sent message so the
+--            thread renders like received replies.
+--
+--            wa_bridge.messages.sender_jid records each message's author as
+--            WhatsApp addresses them (user@s.whatsapp.net or user@lid, no
+--            device), which a quote of another group member's message must
+--            name. sender_id alone lacks the server, and for live group
+--            messages it can hold the group's ID.
+--
+--            Depends on: 20260219000001_tables.sql,
+--                        20260310000002_grant_service_role_messages.sql,
+--                        20260312000001_add_outbox_media.sql
+-- =============================================================================
+
+ALTER TABLE wa_bridge.outgoing_messages
+    ADD COLUMN IF NOT EXISTS reply_to_message_id text;
+
+-- Recreate public.outgoing_messages so the new column is visible.
+CREATE OR REPLACE VIEW public.outgoing_messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.outgoing_messages;
+
+GRANT SELECT, INSERT ON public.outgoing_messages TO authenticated;
+
+ALTER TABLE wa_bridge.messages
+    ADD COLUMN IF NOT EXISTS sender_jid text;
+
+-- Recreate public.messages so the new column is visible.
+CREATE OR REPLACE VIEW public.messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.messages;
+
+GRANT SELECT ON public.messages TO authenticated;
+GRANT SELECT, UPDATE ON public.messages TO service_role;
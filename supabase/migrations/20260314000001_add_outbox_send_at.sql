@@ -0,0 +1,70 @@
+-- =============================================================================
+-- Migration: add_outbox_send_at
+-- Purpose:   Schedule outgoing messages for later delivery and allow them to be
+--            cancelled before they go out.
+--
+--            send_at (optional) is the earliest time the Go bridge may send the
+--            row. The bridge's outbox scheduler sleeps until the earliest due
+--            row — a scheduled send_at or a retry's next_attempt_at — and the
+--            startup drain picks up anything that became due while it was down.
+--
+--            Authenticated users may cancel a message by setting its status to
+--            'cancelled' while it is still 'pending'. The bridge claims rows
+--            with an atomic status = 'pending' check, so a cancelled row is
+--            never sent.
+--
+--            Depends on: 20260219000001_tables.sql,
+--                        20260311000001_add_outbox_retries.sql
+-- =============================================================================
+
+-- -----------------------------------------------------------------------------
+-- 1. Columns and status
+-- -----------------------------------------------------------------------------
+
+ALTER TABLE wa_bridge.outgoing_messages
+    ADD COLUMN IF NOT EXISTS send_at timestamptz;
+
+ALTER TABLE wa_bridge.outgoing_messages
+    DROP CONSTRAINT IF EXISTS outgoing_messages_status_check;
+ALTER TABLE wa_bridge.outgoing_messages
+    ADD CONSTRAINT outgoing_messages_status_check
+    CHECK (status IN ('pending', 'sending', 'sent', 'failed', 'cancelled'));
+
+-- -----------------------------------------------------------------------------
+-- 2. Index
+--    A pending row is due at its retry time if it has one, otherwise at its
+--    scheduled time. Index that expression so the scheduler's MIN() lookup
+--    and the due-row drain stay cheap.
+-- -----------------------------------------------------------------------------
+
+DROP INDEX IF EXISTS wa_bridge.idx_outgoing_messages_next_attempt;
+
+CREATE INDEX IF NOT EXISTS idx_outgoing_messages_due_at
+    ON wa_bridge.outgoing_messages ((COALESCE(next_attempt_at, send_at)))
+    WHERE status = 'pending';
+
+-- -----------------------------------------------------------------------------
+-- 3. Cancellation
+--    Column-level grant restricts authenticated users to the status column;
+--    the policy only allows moving a pending row to 'cancelled'.
+-- -----------------------------------------------------------------------------
+
+GRANT UPDATE (status) ON TABLE wa_bridge.outgoing_messages TO authenticated;
+
+CREATE POLICY "authenticated_cancel_outgoing_messages"
+    ON wa_bridge.outgoing_messages
+    AS PERMISSIVE FOR UPDATE
+    TO authenticated
+    USING (status = 'pending')
+    WITH CHECK (status = 'cancelled');
+
+-- -----------------------------------------------------------------------------
+-- 4. Recreate public.outgoing_messages so the new column is visible
+-- -----------------------------------------------------------------------------
+
+CREATE OR REPLACE VIEW public.outgoing_messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.outgoing_messages;
+
+GRANT SELECT, INSERT ON public.outgoing_messages TO authenticated;
+GRANT UPDATE (status) ON public.outgoing_messages TO authenticated;
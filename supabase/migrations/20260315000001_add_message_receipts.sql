@@ -0,0 +1,71 @@
+-- =============================================================================
+-- Migration: add_message_receipts
+-- Purpose:   Track WhatsApp delivery / read / played receipts for messages we
+--            send so the UI can show ticks and we can report on quotes that
+--            were read but not answered.
+--
+--            delivery_status only moves forward:
+--              sent -> delivered -> read -> played
+--            Each *_at column records the first time that state was reached.
+--            In group chats the state reflects the furthest any participant
+--            has reached.
+--
+--            The same state is mirrored onto wa_bridge.outgoing_messages via
+--            sent_message_id so the outbox view shows it without a join.
+--
+--            Depends on: 20260219000001_tables.sql, 20260219000002_views.sql,
+--                        20260314000001_add_outbox_send_at.sql
+-- =============================================================================
+
+-- -----------------------------------------------------------------------------
+-- 1. wa_bridge.messages
+-- -----------------------------------------------------------------------------
+
+ALTER TABLE wa_bridge.messages
+    ADD COLUMN IF NOT EXISTS delivery_status text
+        CHECK (delivery_status IN ('sent', 'delivered', 'read', 'played')),
+    ADD COLUMN IF NOT EXISTS delivered_at    timestamp without time zone,
+    ADD COLUMN IF NOT EXISTS read_at         timestamp without time zone,
+    ADD COLUMN IF NOT EXISTS played_at       timestamp without time zone;
+
+-- Messages we sent before receipts were tracked are at least 'sent'.
+UPDATE wa_bridge.messages
+    SET delivery_status = 'sent'
+    WHERE is_from_me AND delivery_status IS NULL;
+
+-- -----------------------------------------------------------------------------
+-- 2. wa_bridge.outgoing_messages
+-- -----------------------------------------------------------------------------
+
+ALTER TABLE wa_bridge.outgoing_messages
+    ADD COLUMN IF NOT EXISTS delivery_status text
+        CHECK (delivery_status IN ('sent', 'delivered', 'read', 'played')),
+    ADD COLUMN IF NOT EXISTS delivered_at    timestamptz,
+    ADD COLUMN IF NOT EXISTS read_at         timestamptz,
+    ADD COLUMN IF NOT EXISTS played_at       timestamptz;
+
+UPDATE wa_bridge.outgoing_messages
+    SET delivery_status = 'sent'
+    WHERE status = 'sent' AND delivery_status IS NULL;
+
+-- Receipts are matched by WhatsApp message ID.
+CREATE INDEX IF NOT EXISTS idx_outgoing_messages_sent_message_id
+    ON wa_bridge.outgoing_messages (sent_message_id)
+    WHERE sent_message_id IS NOT NULL;
+
+-- -----------------------------------------------------------------------------
+-- 3. Recreate the public views so the new columns are visible
+-- -----------------------------------------------------------------------------
+
+CREATE OR REPLACE VIEW public.messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.messages;
+
+CREATE OR REPLACE VIEW public.outgoing_messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.outgoing_messages;
+
+GRANT SELECT ON public.messages TO authenticated;
+GRANT SELECT, UPDATE ON public.messages TO service_role;
+GRANT SELECT, INSERT ON public.outgoing_messages TO authenticated;
+GRANT UPDATE (status) ON public.outgoing_messages TO authenticated;
@@ -0,0 +1,81 @@
+-- =============================================================================
+-- Migration: add_message_revocations
+-- Purpose:   Record WhatsApp "deleted for everyone" revocations.
+--
+--            When a message is revoked the Go bridge sets is_revoked and
+--            revoked_at, clears content, and appends the previous content to
+--            edit_history (with a revoked_at key) so the original text is kept
+--            for auditing the same way edits are. Revoked messages are excluded
+--            from the AI agent's chat history.
+--
+--            Depends on: 20260219000001_tables.sql,
+--                        20260303000003_add_customer_to_chats_preview.sql,
+--                        20260307000001_add_message_edit_history.sql,
+--                        20260315000001_add_message_receipts.sql
+-- =============================================================================
+
+-- -----------------------------------------------------------------------------
+-- 1. Columns
+-- -----------------------------------------------------------------------------
+
+ALTER TABLE wa_bridge.messages
+    ADD COLUMN IF NOT EXISTS is_revoked boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS revoked_at timestamp without time zone;
+
+-- -----------------------------------------------------------------------------
+-- 2. Recreate public.messages so the new columns are visible
+-- -----------------------------------------------------------------------------
+
+CREATE OR REPLACE VIEW public.messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.messages;
+
+GRANT SELECT ON public.messages TO authenticated;
+GRANT SELECT, UPDATE ON public.messages TO service_role;
+
+-- -----------------------------------------------------------------------------
+-- 3. Show revoked messages as "[deleted]" in the chat list preview
+--    Only the last_message_content expression changes, so CREATE OR REPLACE
+--    is sufficient and existing grants are preserved.
+-- -----------------------------------------------------------------------------
+
+CREATE OR REPLACE VIEW public.chats_with_preview
+    WITH (security_invoker = on)
+    AS
+SELECT
+    c.chat_id,
+    c.is_group,
+    c.name,
+    c.created_at,
+    c.last_message_at,
+    c.contact_phone_number,
+    c.agent_active,
+    lm.last_message_content,
+    lm.last_message_timestamp,
+    lm.last_message_type,
+    lm.last_message_is_from_me,
+    cust.id   AS customer_id,
+    cust.name AS customer_name
+FROM wa_bridge.chats AS c
+LEFT JOIN public.customers AS cust
+    ON cust.phone_number = c.contact_phone_number
+LEFT JOIN LATERAL (
+    SELECT
+        CASE
+            WHEN m.is_revoked
+                THEN '[deleted]'
+            WHEN m.message_type = 'text' AND m.content IS NOT NULL
+                THEN m.content
+            WHEN m.media_type IS NOT NULL
+                THEN '[' || m.media_type || ']'
+            ELSE
+                '[' || m.message_type || ']'
+        END                                          AS last_message_content,
+        COALESCE(m.timestamp, m.created_at)          AS last_message_timestamp,
+        m.message_type                               AS last_message_type,
+        m.is_from_me                                 AS last_message_is_from_me
+    FROM wa_bridge.messages AS m
+    WHERE m.chat_id = c.chat_id
+    ORDER BY COALESCE(m.timestamp, m.created_at) DESC NULLS LAST
+    LIMIT 1
+) AS lm ON true;
@@ -0,0 +1,111 @@
+-- =============================================================================
+-- Migration: add_location_messages
+-- Purpose:   Store shared and live locations as structured columns instead of
+--            raw protojson in description, and let the outbox send a
+--            location pin.
+--
+--            Incoming LocationMessage / LiveLocationMessage rows are saved
+--            with message_type = 'location', a readable content
+--            ("name, address (lat, long)") and the latitude / longitude /
+--            location_name / location_address / is_live_location columns.
+--
+--            An outgoing_messages row with latitude and longitude set sends a
+--            location instead of text or media; location_name and
+--            location_address are optional. Location rows carry no content
+--            or media.
+--
+--            Depends on: 20260219000001_tables.sql,
+--                        20260312000001_add_outbox_media.sql,
+--                        20260316000001_add_message_revocations.sql
+-- =============================================================================
+
+-- -----------------------------------------------------------------------------
+-- 1. Received and sent locations
+-- -----------------------------------------------------------------------------
+
+ALTER TABLE wa_bridge.messages
+    ADD COLUMN IF NOT EXISTS latitude         double precision,
+    ADD COLUMN IF NOT EXISTS longitude        double precision,
+    ADD COLUMN IF NOT EXISTS location_name    text,
+    ADD COLUMN IF NOT EXISTS location_address text,
+    ADD COLUMN IF NOT EXISTS is_live_location boolean NOT NULL DEFAULT false;
+
+CREATE OR REPLACE VIEW public.messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.messages;
+
+GRANT SELECT ON public.messages TO authenticated;
+GRANT SELECT, UPDATE ON public.messages TO service_role;
+
+-- -----------------------------------------------------------------------------
+-- 2. Outgoing locations
+-- -----------------------------------------------------------------------------
+
+ALTER TABLE wa_bridge.outgoing_messages
+    ADD COLUMN IF NOT EXISTS latitude         double precision,
+    ADD COLUMN IF NOT EXISTS longitude        double precision,
+    ADD COLUMN IF NOT EXISTS location_name    text,
+    ADD COLUMN IF NOT EXISTS location_address text;
+
+ALTER TABLE wa_bridge.outgoing_messages
+    DROP CONSTRAINT IF EXISTS outgoing_messages_content_or_media;
+
+ALTER TABLE wa_bridge.outgoing_messages
+    ADD CONSTRAINT outgoing_messages_content_or_media
+    CHECK (content IS NOT NULL OR media_path IS NOT NULL OR latitude IS NOT NULL),
+    ADD CONSTRAINT outgoing_messages_location_coordinates
+    CHECK ((latitude IS NULL) = (longitude IS NULL)),
+    ADD CONSTRAINT outgoing_messages_location_exclusive
+    CHECK (latitude IS NULL OR (content IS NULL AND media_path IS NULL));
+
+CREATE OR REPLACE VIEW public.outgoing_messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.outgoing_messages;
+
+GRANT SELECT, INSERT ON public.outgoing_messages TO authenticated;
+GRANT UPDATE (status) ON public.outgoing_messages TO authenticated;
+
+-- -----------------------------------------------------------------------------
+-- 3. Show the location text in the chat list preview
+-- -----------------------------------------------------------------------------
+
+CREATE OR REPLACE VIEW public.chats_with_preview
+    WITH (security_invoker = on)
+    AS
+SELECT
+    c.chat_id,
+    c.is_group,
+    c.name,
+    c.created_at,
+    c.last_message_at,
+    c.contact_phone_number,
+    c.agent_active,
+    lm.last_message_content,
+    lm.last_message_timestamp,
+    lm.last_message_type,
+    lm.last_message_is_from_me,
+    cust.id   AS customer_id,
+    cust.name AS customer_name
+FROM wa_bridge.chats AS c
+LEFT JOIN public.customers AS cust
+    ON cust.phone_number = c.contact_phone_number
+LEFT JOIN LATERAL (
+    SELECT
+        CASE
+            WHEN m.is_revoked
+                THEN '[deleted]'
+            WHEN m.message_type IN ('text', 'location') AND m.content IS NOT NULL
+                THEN m.content
+            WHEN m.media_type IS NOT NULL
+                THEN '[' || m.media_type || ']'
+            ELSE
+                '[' || m.message_type || ']'
+        END                                          AS last_message_content,
+        COALESCE(m.timestamp, m.created_at)          AS last_message_timestamp,
+        m.message_type                               AS last_message_type,
+        m.is_from_me                                 AS last_message_is_from_me
+    FROM wa_bridge.messages AS m
+    WHERE m.chat_id = c.chat_id
+    ORDER BY COALESCE(m.timestamp, m.created_at) DESC NULLS LAST
+    LIMIT 1
+) AS lm ON true;
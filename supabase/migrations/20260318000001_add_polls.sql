@@ -0,0 +1,164 @@
+-- =============================================================================
+-- Migration: add_polls
+-- Purpose:   Send WhatsApp polls from the outbox and track the votes, so a
+--            customer can pick one of several quote options by voting.
+--
+--            wa_bridge.polls stores the question and options of every poll
+--            creation message (sent or received). Votes only carry SHA-256
+--            hashes of the option names, so the options are needed to
+--            resolve them. quote_option_ids optionally links each option, by
+--            position, to a public.quote_options row.
+--
+--            wa_bridge.poll_votes holds each voter's current selection,
+--            keyed by the voter's phone number (in groups, the member who
+--            voted, not the group).
+--            WhatsApp sends the full selection with every vote, so the bridge
+--            replaces the row; an empty selected_options array means the vote
+--            was withdrawn. When a customer selects exactly one option linked
+--            to a quote, the bridge marks that quote option as is_selected.
+--
+--            An outgoing_messages row with poll_options set sends a poll
+--            whose question is content.
+--
+--            Depends on: 20260219000001_tables.sql,
+--                        20260227000004_add_flight_requests.sql,
+--                        20260317000001_add_location_messages.sql
+-- =============================================================================
+
+-- =============================================================================
+-- TABLES
+-- =============================================================================
+
+-- -----------------------------------------------------------------------------
+-- wa_bridge.polls
+-- -----------------------------------------------------------------------------
+
+CREATE TABLE "wa_bridge"."polls" (
+    "message_id"       text                        NOT NULL,
+    "chat_id"          text                        NOT NULL,
+    "name"             text                        NOT NULL,
+    "options"          text[]                      NOT NULL,
+    "selectable_count" integer                     NOT NULL DEFAULT 0,
+    "quote_option_ids" uuid[],
+    "created_at"       timestamp without time zone          DEFAULT now(),
+    PRIMARY KEY (message_id, chat_id),
+    CONSTRAINT polls_quote_option_ids_match
+        CHECK (quote_option_ids IS NULL
+               OR cardinality(quote_option_ids) = cardinality(options))
+);
+
+ALTER TABLE "wa_bridge"."polls" ENABLE ROW LEVEL SECURITY;
+
+ALTER TABLE "wa_bridge"."polls"
+    ADD CONSTRAINT "fk_polls_message"
+    FOREIGN KEY (message_id, chat_id) REFERENCES wa_bridge.messages (message_id, chat_id)
+    ON DELETE CASCADE;
+
+-- -----------------------------------------------------------------------------
+-- wa_bridge.poll_votes
+--
+-- One row per (poll, voter). sender FK is NOT VALID for the same reason as
+-- reactions: votes can arrive before the voter's contact row exists.
+-- -----------------------------------------------------------------------------
+
+CREATE TABLE "wa_bridge"."poll_votes" (
+    "poll_message_id"  text                        NOT NULL,
+    "chat_id"          text                        NOT NULL,
+    "voter_id"         text                        NOT NULL,
+    "selected_options" text[]                      NOT NULL DEFAULT '{}',
+    "timestamp"        timestamp without time zone,
+    "created_at"       timestamp without time zone          DEFAULT now(),
+    PRIMARY KEY (poll_message_id, chat_id, voter_id)
+);
+
+ALTER TABLE "wa_bridge"."poll_votes" ENABLE ROW LEVEL SECURITY;
+
+ALTER TABLE "wa_bridge"."poll_votes"
+    ADD CONSTRAINT "fk_poll_votes_poll"
+    FOREIGN KEY (poll_message_id, chat_id) REFERENCES wa_bridge.polls (message_id, chat_id)
+    ON DELETE CASCADE;
+
+ALTER TABLE "wa_bridge"."poll_votes"
+    ADD CONSTRAINT "fk_poll_votes_voter"
+    FOREIGN KEY (voter_id) REFERENCES wa_bridge.contacts (phone_number)
+    NOT VALID;
+
+-- =============================================================================
+-- RLS POLICIES AND GRANTS
+-- =============================================================================
+
+CREATE POLICY "wa_bridge_app_polls"
+    ON "wa_bridge"."polls"
+    AS PERMISSIVE FOR ALL
+    TO wa_bridge_app
+    USING (true)
+    WITH CHECK (true);
+
+CREATE POLICY "authenticated_read_polls"
+    ON "wa_bridge"."polls"
+    AS PERMISSIVE FOR SELECT
+    TO authenticated
+    USING (true);
+
+CREATE POLICY "wa_bridge_app_poll_votes"
+    ON "wa_bridge"."poll_votes"
+    AS PERMISSIVE FOR ALL
+    TO wa_bridge_app
+    USING (true)
+    WITH CHECK (true);
+
+CREATE POLICY "authenticated_read_poll_votes"
+    ON "wa_bridge"."poll_votes"
+    AS PERMISSIVE FOR SELECT
+    TO authenticated
+    USING (true);
+
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE "wa_bridge"."polls"      TO "wa_bridge_app";
+GRANT SELECT, INSERT, UPDATE, DELETE ON TABLE "wa_bridge"."poll_votes" TO "wa_bridge_app";
+GRANT SELECT ON TABLE "wa_bridge"."polls"      TO "authenticated";
+GRANT SELECT ON TABLE "wa_bridge"."poll_votes" TO "authenticated";
+GRANT SELECT ON TABLE "wa_bridge"."polls"      TO "n8n_app";
+GRANT SELECT ON TABLE "wa_bridge"."poll_votes" TO "n8n_app";
+
+-- =============================================================================
+-- OUTGOING POLLS
+-- =============================================================================
+
+ALTER TABLE wa_bridge.outgoing_messages
+    ADD COLUMN IF NOT EXISTS poll_options          text[],
+    ADD COLUMN IF NOT EXISTS poll_selectable_count integer,
+    ADD COLUMN IF NOT EXISTS poll_quote_option_ids uuid[];
+
+-- A poll needs a question (content), at least two options, no media or
+-- location, and at most one quote option per poll option.
+ALTER TABLE wa_bridge.outgoing_messages
+    ADD CONSTRAINT outgoing_messages_poll
+    CHECK (poll_options IS NULL
+           OR (content IS NOT NULL
+               AND cardinality(poll_options) BETWEEN 2 AND 12
+               AND media_path IS NULL
+               AND latitude IS NULL
+               AND (poll_quote_option_ids IS NULL
+                    OR cardinality(poll_quote_option_ids) = cardinality(poll_options))));
+
+-- =============================================================================
+-- VIEWS (public schema)
+-- =============================================================================
+
+CREATE OR REPLACE VIEW public.polls
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.polls;
+
+CREATE OR REPLACE VIEW public.poll_votes
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.poll_votes;
+
+GRANT SELECT ON public.polls      TO authenticated;
+GRANT SELECT ON public.poll_votes TO authenticated;
+
+CREATE OR REPLACE VIEW public.outgoing_messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.outgoing_messages;
+
+GRANT SELECT, INSERT ON public.outgoing_messages TO authenticated;
+GRANT UPDATE (status) ON public.outgoing_messages TO authenticated;
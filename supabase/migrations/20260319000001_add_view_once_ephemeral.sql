@@ -0,0 +1,49 @@
+-- =============================================================================
+-- Migration: add_view_once_ephemeral
+-- Purpose:   Flag view-once and disappearing (ephemeral) messages, and record
+--            each chat's disappearing-messages timer.
+--
+--            The bridge unwraps ViewOnceMessage / ViewOnceMessageV2 /
+--            EphemeralMessage containers and stores the inner content as a
+--            normal row with is_view_once / is_ephemeral set. View-once media
+--            still goes through the media pipeline.
+--
+--            wa_bridge.chats.ephemeral_expiration is the chat's timer in
+--            seconds (0 = off). It is updated from "disappearing messages"
+--            setting changes and from the expiration carried by incoming
+--            ephemeral messages; ephemeral_setting_at is the time of the change
+--            it reflects, so older events never roll it back. The outbox sends
+--            with this expiration so our replies disappear like the customer's.
+--
+--            Depends on: 20260219000001_tables.sql,
+--                        20260302000001_add_agent_active.sql,
+--                        20260318000001_add_polls.sql
+-- =============================================================================
+
+-- -----------------------------------------------------------------------------
+-- 1. Columns
+-- -----------------------------------------------------------------------------
+
+ALTER TABLE wa_bridge.messages
+    ADD COLUMN IF NOT EXISTS is_view_once boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS is_ephemeral boolean NOT NULL DEFAULT false;
+
+ALTER TABLE wa_bridge.chats
+    ADD COLUMN IF NOT EXISTS ephemeral_expiration integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS ephemeral_setting_at timestamp without time zone;
+
+-- -----------------------------------------------------------------------------
+-- 2. Recreate the public views so the new columns are visible
+-- -----------------------------------------------------------------------------
+
+CREATE OR REPLACE VIEW public.messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.messages;
+
+CREATE OR REPLACE VIEW public.chats
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.chats;
+
+GRANT SELECT ON public.messages TO authenticated;
+GRANT SELECT, UPDATE ON public.messages TO service_role;
+GRANT SELECT ON public.chats TO authenticated;
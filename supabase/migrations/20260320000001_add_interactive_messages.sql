@@ -0,0 +1,62 @@
+-- =============================================================================
+-- Migration: add_interactive_messages
+-- Purpose:   Record the choice behind button and list replies, and let the
+--            outbox send button and list messages.
+--
+--            Button replies, list replies, template button replies and
+--            native flow responses are stored as message_type = 'text' with
+--            the tapped title as content and a selection object:
+--              {"type": "button" | "list" | "template_button" | "native_flow",
+--               "id": "<selected id>", "title": "<selected title>",
+--               "params": { ... native flow parameters ... }}
+--
+--            An outgoing_messages row with interactive set sends a buttons or
+--            list message whose body text is content:
+--              {"type": "buttons", "buttons": [{"id", "title"}], "footer"}
+--              {"type": "list", "button_text", "footer",
+--               "sections": [{"title", "rows": [{"id", "title", "description"}]}]}
+--
+--            Depends on: 20260219000001_tables.sql,
+--                        20260319000001_add_view_once_ephemeral.sql
+-- =============================================================================
+
+-- -----------------------------------------------------------------------------
+-- 1. Selections on received replies
+-- -----------------------------------------------------------------------------
+
+ALTER TABLE wa_bridge.messages
+    ADD COLUMN IF NOT EXISTS selection jsonb;
+
+CREATE INDEX IF NOT EXISTS idx_messages_selection_id
+    ON wa_bridge.messages ((selection ->> 'id'))
+    WHERE selection IS NOT NULL;
+
+CREATE OR REPLACE VIEW public.messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.messages;
+
+GRANT SELECT ON public.messages TO authenticated;
+GRANT SELECT, UPDATE ON public.messages TO service_role;
+
+-- -----------------------------------------------------------------------------
+-- 2. Outgoing button and list messages
+-- -----------------------------------------------------------------------------
+
+ALTER TABLE wa_bridge.outgoing_messages
+    ADD COLUMN IF NOT EXISTS interactive jsonb;
+
+ALTER TABLE wa_bridge.outgoing_messages
+    ADD CONSTRAINT outgoing_messages_interactive
+    CHECK (interactive IS NULL
+           OR (interactive ->> 'type' IN ('buttons', 'list')
+               AND content IS NOT NULL
+               AND media_path IS NULL
+               AND latitude IS NULL
+               AND poll_options IS NULL));
+
+CREATE OR REPLACE VIEW public.outgoing_messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.outgoing_messages;
+
+GRANT SELECT, INSERT ON public.outgoing_messages TO authenticated;
+GRANT UPDATE (status) ON public.outgoing_messages TO authenticated;
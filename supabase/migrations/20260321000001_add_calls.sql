@@ -0,0 +1,74 @@
+-- =============================================================================
+-- Migration: add_calls
+-- Purpose:   Record incoming WhatsApp voice and video calls.
+--
+--            Each call is a row in the chat timeline (wa_bridge.messages with
+--            message_type = 'call' and message_id = the call ID) whose content
+--            reads e.g. "Missed voice call" or "Answered video call (2:15)",
+--            plus a wa_bridge.calls row with the details. status moves from
+--            'ringing' to 'answered' (picked up on one of our devices),
+--            'rejected' (auto-rejected by the bridge) or 'missed'.
+--
+--            Depends on: 20260219000001_tables.sql,
+--                        20260320000001_add_interactive_messages.sql
+-- =============================================================================
+
+-- =============================================================================
+-- TABLE
+-- =============================================================================
+
+CREATE TABLE "wa_bridge"."calls" (
+    "call_id"          text                        NOT NULL PRIMARY KEY,
+    "chat_id"          text                        NOT NULL,
+    "caller_id"        text,
+    "is_video"         boolean                     NOT NULL DEFAULT false,
+    "status"           text                        NOT NULL DEFAULT 'ringing'
+        CHECK (status IN ('ringing', 'answered', 'missed', 'rejected')),
+    "offered_at"       timestamp without time zone NOT NULL,
+    "answered_at"      timestamp without time zone,
+    "ended_at"         timestamp without time zone,
+    "duration_seconds" integer,
+    "terminate_reason" text,
+    "created_at"       timestamp without time zone          DEFAULT now()
+);
+
+ALTER TABLE "wa_bridge"."calls" ENABLE ROW LEVEL SECURITY;
+
+-- The timeline row shares the call ID as its message_id.
+ALTER TABLE "wa_bridge"."calls"
+    ADD CONSTRAINT "fk_calls_message"
+    FOREIGN KEY (call_id, chat_id) REFERENCES wa_bridge.messages (message_id, chat_id)
+    ON DELETE CASCADE;
+
+CREATE INDEX idx_calls_chat_id ON wa_bridge.calls (chat_id, offered_at DESC);
+
+-- =============================================================================
+-- RLS POLICIES AND GRANTS
+-- =============================================================================
+
+CREATE POLICY "wa_bridge_app_calls"
+    ON "wa_bridge"."calls"
+    AS PERMISSIVE FOR ALL
+    TO wa_bridge_app
+    USING (true)
+    WITH CHECK (true);
+
+CREATE POLICY "authenticated_read_calls"
+    ON "wa_bridge"."calls"
+    AS PERMISSIVE FOR SELECT
+    TO authenticated
+    USING (true);
+
+GRANT SELECT, INSERT, UPDATE ON TABLE "wa_bridge"."calls" TO "wa_bridge_app";
+GRANT SELECT ON TABLE "wa_bridge"."calls" TO "authenticated";
+GRANT SELECT ON TABLE "wa_bridge"."calls" TO "n8n_app";
+
+-- =============================================================================
+-- VIEW (public schema)
+-- =============================================================================
+
+CREATE OR REPLACE VIEW public.calls
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.calls;
+
+GRANT SELECT ON public.calls TO authenticated;
@@ -0,0 +1,90 @@
+-- =============================================================================
+-- Migration: add_group_participants
+-- Purpose:   Track group membership and metadata.
+--
+--            wa_bridge.group_participants holds one row per (group, member),
+--            keyed by the member's phone number. Rows are never deleted: a
+--            member who leaves keeps their row with is_active = false and
+--            left_at set, so past trips still show who took part. joined_at,
+--            promoted_at and demoted_at record the latest such change.
+--            The bridge syncs the full member list on startup and applies
+--            join/leave/promote/demote events as they arrive.
+--
+--            wa_bridge.chats gains "topic" (the group description), kept up
+--            to date alongside the name when a group is renamed.
+--
+--            Depends on: 20260219000001_tables.sql,
+--                        20260321000001_add_calls.sql
+-- =============================================================================
+
+-- =============================================================================
+-- 1. Group topic on chats
+-- =============================================================================
+
+ALTER TABLE wa_bridge.chats
+    ADD COLUMN IF NOT EXISTS topic text;
+
+CREATE OR REPLACE VIEW public.chats
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.chats;
+
+GRANT SELECT ON public.chats TO authenticated;
+
+-- =============================================================================
+-- 2. TABLE
+-- =============================================================================
+
+CREATE TABLE "wa_bridge"."group_participants" (
+    "chat_id"        text                        NOT NULL,
+    "participant_id" text                        NOT NULL,
+    "is_admin"       boolean                     NOT NULL DEFAULT false,
+    "is_super_admin" boolean                     NOT NULL DEFAULT false,
+    "is_active"      boolean                     NOT NULL DEFAULT true,
+    "joined_at"      timestamp without time zone,
+    "left_at"        timestamp without time zone,
+    "promoted_at"    timestamp without time zone,
+    "demoted_at"     timestamp without time zone,
+    "updated_at"     timestamp without time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (chat_id, participant_id)
+);
+
+ALTER TABLE "wa_bridge"."group_participants" ENABLE ROW LEVEL SECURITY;
+
+ALTER TABLE "wa_bridge"."group_participants"
+    ADD CONSTRAINT "fk_group_participants_chat"
+    FOREIGN KEY (chat_id) REFERENCES wa_bridge.chats (chat_id)
+    ON DELETE CASCADE;
+
+CREATE INDEX idx_group_participants_participant
+    ON wa_bridge.group_participants (participant_id);
+
+-- =============================================================================
+-- RLS POLICIES AND GRANTS
+-- =============================================================================
+
+CREATE POLICY "wa_bridge_app_group_participants"
+    ON "wa_bridge"."group_participants"
+    AS PERMISSIVE FOR ALL
+    TO wa_bridge_app
+    USING (true)
+    WITH CHECK (true);
+
+CREATE POLICY "authenticated_read_group_participants"
+    ON "wa_bridge"."group_participants"
+    AS PERMISSIVE FOR SELECT
+    TO authenticated
+    USING (true);
+
+GRANT SELECT, INSERT, UPDATE ON TABLE "wa_bridge"."group_participants" TO "wa_bridge_app";
+GRANT SELECT ON TABLE "wa_bridge"."group_participants" TO "authenticated";
+GRANT SELECT ON TABLE "wa_bridge"."group_participants" TO "n8n_app";
+
+-- =============================================================================
+-- VIEW (public schema)
+-- =============================================================================
+
+CREATE OR REPLACE VIEW public.group_participants
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.group_participants;
+
+GRANT SELECT ON public.group_participants TO authenticated;
@@ -0,0 +1,43 @@
+-- =============================================================================
+-- Migration: add_group_commands
+-- Purpose:   Allow bridge commands that are not tied to an existing chat.
+--
+--            create_group has no chat_id when it is inserted; the new group's
+--            JID is written to result (together with the invite link) once
+--            WhatsApp has created it, and its wa_bridge.chats row is created
+--            at the same time. All other command types still require
+--            chat_id.
+--
+--            Realtime broadcasts for commands without a chat go to the
+--            "commands:<command_type>" topic (e.g. commands:create_group).
+--
+--            Depends on: 20260303000001_add_bridge_commands.sql,
+--                        20260322000001_add_group_participants.sql
+-- =============================================================================
+
+ALTER TABLE wa_bridge.bridge_commands
+    ALTER COLUMN chat_id DROP NOT NULL;
+
+ALTER TABLE wa_bridge.bridge_commands
+    ADD CONSTRAINT bridge_commands_chat_required
+    CHECK (chat_id IS NOT NULL OR command_type = 'create_group');
+
+CREATE OR REPLACE FUNCTION wa_bridge.broadcast_bridge_command_changes()
+RETURNS trigger
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = ''
+AS $$
+BEGIN
+    PERFORM realtime.broadcast_changes(
+        'commands:' || COALESCE(NEW.chat_id, OLD.chat_id, NEW.command_type),
+        TG_OP,
+        TG_OP,
+        TG_TABLE_NAME,
+        TG_TABLE_SCHEMA,
+        NEW,
+        OLD
+    );
+    RETURN NULL;
+END;
+$$;
@@ -0,0 +1,84 @@
+-- =============================================================================
+-- Migration: add_history_sync_ingestion
+-- Purpose:   Keep the chats, messages and push names WhatsApp sends in the
+--            history syncs right after pairing (INITIAL_BOOTSTRAP, RECENT,
+--            FULL, PUSH_NAME), not only ON_DEMAND responses.
+--
+--            wa_bridge.chats gains the phone's chat state as of the sync:
+--            is_archived, pinned_at, muted_until (9999-12-31 for "always"),
+--            unread_count and is_marked_unread.
+--
+--            wa_bridge.history_sync_status has one row per sync type with
+--            the latest progress percentage (0-100) and running totals.
+--            completed_at is set once progress reaches 100; a later chunk of
+--            the same type (e.g. after re-linking) starts a new run.
+--
+--            Depends on: 20260219000001_tables.sql,
+--                        20260323000001_add_group_commands.sql
+-- =============================================================================
+
+-- =============================================================================
+-- 1. Chat state columns
+-- =============================================================================
+
+ALTER TABLE wa_bridge.chats
+    ADD COLUMN IF NOT EXISTS is_archived      boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS pinned_at        timestamp without time zone,
+    ADD COLUMN IF NOT EXISTS muted_until      timestamp without time zone,
+    ADD COLUMN IF NOT EXISTS unread_count     integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS is_marked_unread boolean NOT NULL DEFAULT false;
+
+CREATE OR REPLACE VIEW public.chats
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.chats;
+
+GRANT SELECT ON public.chats TO authenticated;
+
+-- =============================================================================
+-- 2. TABLE
+-- =============================================================================
+
+CREATE TABLE "wa_bridge"."history_sync_status" (
+    "sync_type"     text        NOT NULL PRIMARY KEY,
+    "progress"      integer     NOT NULL DEFAULT 0,
+    "chunks"        integer     NOT NULL DEFAULT 0,
+    "conversations" integer     NOT NULL DEFAULT 0,
+    "messages"      integer     NOT NULL DEFAULT 0,
+    "push_names"    integer     NOT NULL DEFAULT 0,
+    "started_at"    timestamptz NOT NULL DEFAULT now(),
+    "updated_at"    timestamptz NOT NULL DEFAULT now(),
+    "completed_at"  timestamptz
+);
+
+ALTER TABLE "wa_bridge"."history_sync_status" ENABLE ROW LEVEL SECURITY;
+
+-- =============================================================================
+-- RLS POLICIES AND GRANTS
+-- =============================================================================
+
+CREATE POLICY "wa_bridge_app_history_sync_status"
+    ON "wa_bridge"."history_sync_status"
+    AS PERMISSIVE FOR ALL
+    TO wa_bridge_app
+    USING (true)
+    WITH CHECK (true);
+
+CREATE POLICY "authenticated_read_history_sync_status"
+    ON "wa_bridge"."history_sync_status"
+    AS PERMISSIVE FOR SELECT
+    TO authenticated
+    USING (true);
+
+GRANT SELECT, INSERT, UPDATE ON TABLE "wa_bridge"."history_sync_status" TO "wa_bridge_app";
+GRANT SELECT ON TABLE "wa_bridge"."history_sync_status" TO "authenticated";
+GRANT SELECT ON TABLE "wa_bridge"."history_sync_status" TO "n8n_app";
+
+-- =============================================================================
+-- VIEW (public schema)
+-- =============================================================================
+
+CREATE OR REPLACE VIEW public.history_sync_status
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.history_sync_status;
+
+GRANT SELECT ON public.history_sync_status TO authenticated;
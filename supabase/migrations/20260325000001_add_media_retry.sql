@@ -0,0 +1,89 @@
+-- =============================================================================
+-- Migration: add_media_retry
+-- Purpose:   Track whether an incoming attachment made it to storage, and keep
+--            what is needed to fetch it again.
+--
+--            wa_bridge.messages gains:
+--              media_status          — pending, stored, download_failed,
+--                                      upload_failed or unavailable (neither
+--                                      the CDN nor the sender's phone has the
+--                                      file any more). NULL for non-media rows.
+--              media_error           — the last failure message.
+--              media_attempts        — download attempts so far.
+--              media_last_attempt_at — when the last attempt ended.
+--
+--            wa_bridge.media_keys holds the CDN path and decryption keys of
+--            each incoming attachment. It is only readable by the bridge:
+--            there is no authenticated policy and no public view.
+--
+--            The bridge retries failed media every 10 minutes with a
+--            15-minute-per-attempt backoff (MEDIA_RETRY_MAX_ATTEMPTS), and the
+--            retry_media bridge command retries one message on demand.
+--
+--            Depends on: 20260219000001_tables.sql,
+--                        20260324000001_add_history_sync_ingestion.sql
+-- =============================================================================
+
+-- =============================================================================
+-- 1. Media state on messages
+-- =============================================================================
+
+ALTER TABLE wa_bridge.messages
+    ADD COLUMN IF NOT EXISTS media_status          text
+        CHECK (media_status IN ('pending', 'stored', 'download_failed', 'upload_failed', 'unavailable')),
+    ADD COLUMN IF NOT EXISTS media_error           text,
+    ADD COLUMN IF NOT EXISTS media_attempts        integer NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS media_last_attempt_at timestamp without time zone;
+
+UPDATE wa_bridge.messages
+SET media_status = CASE WHEN media_path IS NOT NULL THEN 'stored' ELSE 'pending' END
+WHERE message_type = 'media' AND media_status IS NULL;
+
+-- Retry sweep: only rows still missing their file.
+CREATE INDEX idx_messages_media_missing
+    ON wa_bridge.messages (media_status, media_last_attempt_at)
+    WHERE media_path IS NULL AND media_status IS NOT NULL;
+
+CREATE OR REPLACE VIEW public.messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.messages;
+
+GRANT SELECT ON public.messages TO authenticated;
+GRANT SELECT, UPDATE ON public.messages TO service_role;
+
+-- =============================================================================
+-- 2. TABLE
+-- =============================================================================
+
+CREATE TABLE "wa_bridge"."media_keys" (
+    "message_id"      text   NOT NULL,
+    "chat_id"         text   NOT NULL,
+    "direct_path"     text,
+    "media_key"       bytea,
+    "file_sha256"     bytea,
+    "file_enc_sha256" bytea,
+    "file_length"     bigint,
+    "mime_type"       text,
+    "created_at"      timestamp without time zone DEFAULT now(),
+    PRIMARY KEY (message_id, chat_id)
+);
+
+ALTER TABLE "wa_bridge"."media_keys" ENABLE ROW LEVEL SECURITY;
+
+ALTER TABLE "wa_bridge"."media_keys"
+    ADD CONSTRAINT "fk_media_keys_message"
+    FOREIGN KEY (message_id, chat_id) REFERENCES wa_bridge.messages (message_id, chat_id)
+    ON DELETE CASCADE;
+
+-- =============================================================================
+-- RLS POLICIES AND GRANTS
+-- =============================================================================
+
+CREATE POLICY "wa_bridge_app_media_keys"
+    ON "wa_bridge"."media_keys"
+    AS PERMISSIVE FOR ALL
+    TO wa_bridge_app
+    USING (true)
+    WITH CHECK (true);
+
+GRANT SELECT, INSERT, UPDATE ON TABLE "wa_bridge"."media_keys" TO "wa_bridge_app";
@@ -0,0 +1,35 @@
+-- =============================================================================
+-- Migration: add_media_metadata
+-- Purpose:   Keep the file metadata WhatsApp sends with each attachment on
+--            the message row:
+--              media_mime_type        — e.g. application/pdf
+--              media_filename         — original document file name
+--              media_size             — bytes
+--              media_sha256           — hex SHA-256 of the plaintext file
+--              media_width / media_height — images, videos and stickers
+--              media_duration_seconds — audio and video
+--              media_page_count       — documents
+--
+--            Documents are now stored as {chat_id}/{message_id}/{file name}
+--            so they download under their original name; other media keep
+--            the {chat_id}/{message_id}.{ext} layout.
+--
+--            Depends on: 20260325000001_add_media_retry.sql
+-- =============================================================================
+
+ALTER TABLE wa_bridge.messages
+    ADD COLUMN IF NOT EXISTS media_mime_type        text,
+    ADD COLUMN IF NOT EXISTS media_filename         text,
+    ADD COLUMN IF NOT EXISTS media_size             bigint,
+    ADD COLUMN IF NOT EXISTS media_sha256           text,
+    ADD COLUMN IF NOT EXISTS media_width            integer,
+    ADD COLUMN IF NOT EXISTS media_height           integer,
+    ADD COLUMN IF NOT EXISTS media_duration_seconds integer,
+    ADD COLUMN IF NOT EXISTS media_page_count       integer;
+
+CREATE OR REPLACE VIEW public.messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.messages;
+
+GRANT SELECT ON public.messages TO authenticated;
+GRANT SELECT, UPDATE ON public.messages TO service_role;
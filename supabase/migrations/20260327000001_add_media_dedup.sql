@@ -0,0 +1,130 @@
+-- =============================================================================
+-- Migration: add_media_dedup
+-- Purpose:   Store each distinct media file once, addressed by the SHA-256 of
+--            its content, instead of one copy per message.
+--
+--            wa_bridge.media_blobs — one row per stored file, at
+--              wa-media/blobs/{first two hex digits}/{sha256}.{ext}.
+--            wa_bridge.message_media — which blob each message's attachment
+--              is. messages.media_path is still set to the blob's path, so
+--              readers of media_path need no change.
+--
+--            The bridge looks the hash up before uploading (and, for
+--            background downloads, before downloading) and reuses the
+--            existing blob when there is one.
+--
+--            Existing stored media is registered as blobs where the hash is
+--            known (media_sha256), using the oldest copy; later duplicates
+--            will point at it. Older duplicate copies stay where they are.
+--
+--            Depends on: 20260326000001_add_media_metadata.sql
+-- =============================================================================
+
+-- =============================================================================
+-- 1. TABLES
+-- =============================================================================
+
+CREATE TABLE "wa_bridge"."media_blobs" (
+    "sha256"     text                        NOT NULL,
+    "bucket"     text                        NOT NULL DEFAULT 'wa-media',
+    "path"       text                        NOT NULL,
+    "mime_type"  text,
+    "size"       bigint,
+    "created_at" timestamp without time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (sha256)
+);
+
+ALTER TABLE "wa_bridge"."media_blobs" ENABLE ROW LEVEL SECURITY;
+
+CREATE TABLE "wa_bridge"."message_media" (
+    "message_id" text                        NOT NULL,
+    "chat_id"    text                        NOT NULL,
+    "sha256"     text                        NOT NULL,
+    "created_at" timestamp without time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (message_id, chat_id)
+);
+
+ALTER TABLE "wa_bridge"."message_media" ENABLE ROW LEVEL SECURITY;
+
+ALTER TABLE "wa_bridge"."message_media"
+    ADD CONSTRAINT "fk_message_media_message"
+    FOREIGN KEY (message_id, chat_id) REFERENCES wa_bridge.messages (message_id, chat_id)
+    ON DELETE CASCADE;
+
+ALTER TABLE "wa_bridge"."message_media"
+    ADD CONSTRAINT "fk_message_media_blob"
+    FOREIGN KEY (sha256) REFERENCES wa_bridge.media_blobs (sha256);
+
+CREATE INDEX idx_message_media_sha256
+    ON wa_bridge.message_media (sha256);
+
+-- =============================================================================
+-- 2. Register existing media
+-- =============================================================================
+
+INSERT INTO wa_bridge.media_blobs (sha256, path, mime_type, size)
+SELECT DISTINCT ON (media_sha256) media_sha256, media_path, media_mime_type, media_size
+FROM wa_bridge.messages
+WHERE media_sha256 IS NOT NULL AND media_path IS NOT NULL AND media_status = 'stored'
+ORDER BY media_sha256, timestamp
+ON CONFLICT (sha256) DO NOTHING;
+
+INSERT INTO wa_bridge.message_media (message_id, chat_id, sha256)
+SELECT m.message_id, m.chat_id, b.sha256
+FROM wa_bridge.messages m
+JOIN wa_bridge.media_blobs b ON b.sha256 = m.media_sha256 AND b.path = m.media_path
+ON CONFLICT (message_id, chat_id) DO NOTHING;
+
+-- =============================================================================
+-- RLS POLICIES AND GRANTS
+-- =============================================================================
+
+CREATE POLICY "wa_bridge_app_media_blobs"
+    ON "wa_bridge"."media_blobs"
+    AS PERMISSIVE FOR ALL
+    TO wa_bridge_app
+    USING (true)
+    WITH CHECK (true);
+
+CREATE POLICY "authenticated_read_media_blobs"
+    ON "wa_bridge"."media_blobs"
+    AS PERMISSIVE FOR SELECT
+    TO authenticated
+    USING (true);
+
+CREATE POLICY "wa_bridge_app_message_media"
+    ON "wa_bridge"."message_media"
+    AS PERMISSIVE FOR ALL
+    TO wa_bridge_app
+    USING (true)
+    WITH CHECK (true);
+
+CREATE POLICY "authenticated_read_message_media"
+    ON "wa_bridge"."message_media"
+    AS PERMISSIVE FOR SELECT
+    TO authenticated
+    USING (true);
+
+GRANT SELECT, INSERT, UPDATE ON TABLE "wa_bridge"."media_blobs" TO "wa_bridge_app";
+GRANT SELECT ON TABLE "wa_bridge"."media_blobs" TO "authenticated";
+GRANT SELECT ON TABLE "wa_bridge"."media_blobs" TO "n8n_app";
+
+GRANT SELECT, INSERT, UPDATE ON TABLE "wa_bridge"."message_media" TO "wa_bridge_app";
+GRANT SELECT ON TABLE "wa_bridge"."message_media" TO "authenticated";
+GRANT SELECT ON TABLE "wa_bridge"."message_media" TO "n8n_app";
+
+-- =============================================================================
+-- VIEWS (public schema)
+-- =============================================================================
+
+CREATE OR REPLACE VIEW public.media_blobs
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.media_blobs;
+
+GRANT SELECT ON public.media_blobs TO authenticated;
+
+CREATE OR REPLACE VIEW public.message_media
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.message_media;
+
+GRANT SELECT ON public.message_media TO authenticated;
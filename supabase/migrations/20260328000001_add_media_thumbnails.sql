@@ -0,0 +1,31 @@
+-- =============================================================================
+-- Migration: add_media_thumbnails
+-- Purpose:   Small JPEG previews of media so chat views don't download the
+--            full file for every bubble.
+--
+--            wa_bridge.messages gains thumbnail_path — the preview's path in
+--            the wa-media bucket (thumbnails/{xx}/{sha256}.jpg), set next to
+--            media_path. The preview is the JPEG thumbnail WhatsApp embeds in
+--            image, video and document messages, else a downscaled image, else
+--            a render of a PDF's first page.
+--
+--            wa_bridge.media_keys gains jpeg_thumbnail so background
+--            downloads (history syncs, retries) can store the embedded
+--            preview too.
+--
+--            Depends on: 20260325000001_add_media_retry.sql,
+--                        20260327000001_add_media_dedup.sql
+-- =============================================================================
+
+ALTER TABLE wa_bridge.messages
+    ADD COLUMN IF NOT EXISTS thumbnail_path text;
+
+ALTER TABLE wa_bridge.media_keys
+    ADD COLUMN IF NOT EXISTS jpeg_thumbnail bytea;
+
+CREATE OR REPLACE VIEW public.messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.messages;
+
+GRANT SELECT ON public.messages TO authenticated;
+GRANT SELECT, UPDATE ON public.messages TO service_role;
@@ -0,0 +1,18 @@
+-- =============================================================================
+-- Migration: add_media_size_limits
+-- Purpose:   Record attachments the bridge chose not to download because they
+--            exceed the per-type size limit (MEDIA_MAX_IMAGE_MB,
+--            MEDIA_MAX_VIDEO_MB, MEDIA_MAX_AUDIO_MB, MEDIA_MAX_DOCUMENT_MB).
+--
+--            media_status gains 'skipped_too_large'; media_error holds the
+--            file size and the limit. The retry sweep ignores these rows.
+--
+--            Depends on: 20260325000001_add_media_retry.sql
+-- =============================================================================
+
+ALTER TABLE wa_bridge.messages
+    DROP CONSTRAINT IF EXISTS messages_media_status_check;
+
+ALTER TABLE wa_bridge.messages
+    ADD CONSTRAINT messages_media_status_check
+    CHECK (media_status IN ('pending', 'stored', 'download_failed', 'upload_failed', 'unavailable', 'skipped_too_large'));
@@ -0,0 +1,82 @@
+-- =============================================================================
+-- Migration: add_media_retention
+-- Purpose:   Support the bridge's media retention policy (MEDIA_RETENTION).
+--            A periodic sweep deletes, or moves to the wa-media-archive
+--            bucket, stored files older than the configured age for their
+--            media type and chat class (customer or group).
+--
+--            media_status gains 'expired' and wa_bridge.messages gains
+--            media_expired_at so the UI can explain why an attachment is
+--            gone. media_path is kept; with MEDIA_RETENTION_ACTION=archive
+--            the file lives at the same path in the archive bucket.
+--            Thumbnails (thumbnail_path) are not expired.
+--
+--            Media referenced from public.documents (by message or by
+--            storage_path) is never expired, so the bridge needs read access
+--            to those columns. public.documents belongs to wa-sales; when it
+--            is created after this migration, the grant and policy at the end
+--            must be applied by hand (see README, Media storage). The bridge
+--            skips retention until it can read the table.
+--
+--            Depends on: 20260327000001_add_media_dedup.sql,
+--                        20260329000001_add_media_size_limits.sql
+-- =============================================================================
+
+ALTER TABLE wa_bridge.messages
+    ADD COLUMN IF NOT EXISTS media_expired_at timestamptz;
+
+ALTER TABLE wa_bridge.messages
+    DROP CONSTRAINT IF EXISTS messages_media_status_check;
+
+ALTER TABLE wa_bridge.messages
+    ADD CONSTRAINT messages_media_status_check
+    CHECK (media_status IN ('pending', 'stored', 'download_failed', 'upload_failed', 'unavailable', 'skipped_too_large', 'expired'));
+
+-- Retention scans stored media oldest first.
+CREATE INDEX IF NOT EXISTS idx_messages_media_stored_timestamp
+    ON wa_bridge.messages (timestamp)
+    WHERE media_status = 'stored';
+
+CREATE OR REPLACE VIEW public.messages
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.messages;
+
+GRANT SELECT ON public.messages TO authenticated;
+GRANT SELECT, UPDATE ON public.messages TO service_role;
+
+-- Releasing an expired blob first marks it released_at, which keeps it from
+-- being reused or linked while its file is removed outside the transaction,
+-- then drops its row and message links so the same content is uploaded again
+-- if it is ever received later.
+ALTER TABLE wa_bridge.media_blobs
+    ADD COLUMN IF NOT EXISTS released_at timestamptz;
+
+CREATE OR REPLACE VIEW public.media_blobs
+    WITH (security_invoker = on)
+    AS SELECT * FROM wa_bridge.media_blobs;
+
+GRANT SELECT ON public.media_blobs TO authenticated;
+
+GRANT DELETE ON TABLE "wa_bridge"."media_blobs" TO "wa_bridge_app";
+GRANT DELETE ON TABLE "wa_bridge"."message_media" TO "wa_bridge_app";
+
+-- Private archive bucket; only the bridge (service key) reads or writes it.
+INSERT INTO storage.buckets (id, name, public)
+    VALUES ('wa-media-archive', 'wa-media-archive', false)
+    ON CONFLICT (id) DO NOTHING;
+
+-- public.documents belongs to wa-sales and may not exist yet; if it is
+-- created later, run this GRANT and CREATE POLICY manually.
+DO $$
+BEGIN
+    IF to_regclass('public.documents') IS NOT NULL THEN
+        GRANT SELECT (message_id, chat_id, storage_path) ON public.documents TO wa_bridge_app;
+        DROP POLICY IF EXISTS "wa_bridge_app_read_documents" ON public.documents;
+        CREATE POLICY "wa_bridge_app_read_documents"
+            ON public.documents
+            FOR SELECT
+            TO wa_bridge_app
+            USING (true);
+    END IF;
+END
+$$;
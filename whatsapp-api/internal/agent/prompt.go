@@ -275,6 +275,12 @@ func buildUserMessage(messages []ChatMessage) string {
 			}
 		case "contact":
 			content = fmt.Sprintf("[contato] %s", m.Content)
+		case "location":
+			content = fmt.Sprintf("[localização] %s", m.Content)
+		case "poll":
+			content = fmt.Sprintf("[enquete] %s", m.Content)
+		case "call":
+			content = fmt.Sprintf("[ligação] %s", m.Content)
 		default:
 			content = m.Content
 		}
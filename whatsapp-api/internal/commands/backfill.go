@@ -0,0 +1,251 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-bridge/internal/store"
+)
+
+const (
+	backfillPageSize  = 50
+	backfillPageDelay = 2 * time.Second
+)
+
+// errBackfillTimeout is returned by requestBackfillPage when the phone does
+// not answer. The phone sends no reply matching the chat once there is
+// nothing older, so after the first page this means the start was reached.
+var errBackfillTimeout = errors.New("history sync timed out after 60s — phone may be offline or unreachable")
+
+// backfillPayload is the expected JSON shape for backfill_chat commands.
+// The job stops at whichever limit is reached first, or when the phone has
+// no older messages. With neither limit set it fetches the whole chat.
+type backfillPayload struct {
+	Until       string `json:"until"`        // RFC 3339 timestamp or YYYY-MM-DD
+	MaxMessages int    `json:"max_messages"` // total messages to fetch
+	PageSize    int    `json:"page_size"`    // messages per request, at most 50
+}
+
+// backfillProgress is written to bridge_commands.result after every page.
+type backfillProgress struct {
+	Status           string    `json:"status"` // running, reached_date, reached_count or reached_start
+	Pages            int       `json:"pages"`
+	MessagesReceived int       `json:"messages_received"`
+	OldestMessageID  string    `json:"oldest_message_id"`
+	OldestTimestamp  time.Time `json:"oldest_timestamp"`
+}
+
+func (l *Listener) handleBackfillChat(ctx context.Context, cmd *store.BridgeCommand) {
+	var payload backfillPayload
+	if err := json.Unmarshal(cmd.Payload, &payload); err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("invalid payload: %v", err))
+		return
+	}
+
+	var until time.Time
+	if payload.Until != "" {
+		var err error
+		until, err = time.Parse(time.RFC3339Nano, payload.Until)
+		if err != nil {
+			until, err = time.Parse("2006-01-02", payload.Until)
+			if err != nil {
+				l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("invalid until: %v", err))
+				return
+			}
+		}
+	}
+
+	pageSize := payload.PageSize
+	if pageSize <= 0 || pageSize > backfillPageSize {
+		pageSize = backfillPageSize
+	}
+
+	chatJID, err := types.ParseJID(cmd.ChatID)
+	if err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("invalid chat_id JID: %v", err))
+		return
+	}
+
+	// Only one backfill or history sync per chat at a time.
+	chatKey := chatJID.String()
+	l.mu.Lock()
+	if _, exists := l.backfills[chatKey]; exists {
+		l.mu.Unlock()
+		l.db.MarkCommandFailed(ctx, cmd.ID, "a backfill is already in progress for this chat")
+		return
+	}
+	if _, exists := l.pendingSyncs[chatKey]; exists {
+		l.mu.Unlock()
+		l.db.MarkCommandFailed(ctx, cmd.ID, "another history sync is already in progress for this chat")
+		return
+	}
+	l.backfills[chatKey] = cmd.ID
+	l.mu.Unlock()
+
+	// Pages take seconds each, so run the job in the background rather than
+	// holding up the pending-command drain.
+	go func() {
+		defer func() {
+			l.mu.Lock()
+			delete(l.backfills, chatKey)
+			l.mu.Unlock()
+		}()
+		l.runBackfill(ctx, cmd.ID, chatJID, until, payload.MaxMessages, pageSize, resumeBackfill(cmd))
+	}()
+}
+
+// resumeBackfill returns the starting progress of a backfill: zero for a new
+// command, or the counts saved before a restart for a requeued one.
+func resumeBackfill(cmd *store.BridgeCommand) backfillProgress {
+	var progress backfillProgress
+	if len(cmd.Result) > 0 {
+		if err := json.Unmarshal(cmd.Result, &progress); err != nil {
+			log.Warn().Err(err).Int64("command_id", cmd.ID).Msg("ignoring unreadable backfill progress")
+			progress = backfillProgress{}
+		}
+	}
+	progress.Status = "running"
+	// The anchor is looked up again; an unchanged one must not read as the
+	// start of the chat.
+	progress.OldestMessageID = ""
+	return progress
+}
+
+// runBackfill walks a chat's history backwards, one on-demand history sync
+// per page, anchored on the oldest stored message each time.
+func (l *Listener) runBackfill(ctx context.Context, commandID int64, chatJID types.JID, until time.Time, maxMessages, pageSize int, progress backfillProgress) {
+	chatID := chatJID.String()
+
+	for {
+		anchor, err := l.db.OldestMessage(ctx, chatID)
+		if err == sql.ErrNoRows {
+			l.db.MarkCommandFailed(ctx, commandID, "no stored messages in this chat to start the backfill from")
+			return
+		} else if err != nil {
+			l.db.MarkCommandFailed(ctx, commandID, fmt.Sprintf("failed to look up oldest message: %v", err))
+			return
+		}
+
+		// The phone returned nothing older than what we already had.
+		if progress.Pages > 0 && anchor.MessageID == progress.OldestMessageID {
+			progress.Status = "reached_start"
+		}
+		progress.OldestMessageID = anchor.MessageID
+		progress.OldestTimestamp = anchor.Timestamp
+
+		switch {
+		case progress.Status != "running":
+		case !until.IsZero() && !anchor.Timestamp.After(until):
+			progress.Status = "reached_date"
+		case maxMessages > 0 && progress.MessagesReceived >= maxMessages:
+			progress.Status = "reached_count"
+		}
+		if progress.Status != "running" {
+			result, _ := json.Marshal(progress)
+			if err := l.db.MarkCommandCompleted(ctx, commandID, result); err != nil {
+				log.Error().Err(err).Int64("command_id", commandID).Msg("failed to mark command completed")
+			}
+			log.Info().Int64("command_id", commandID).Str("chat_id", chatID).Str("status", progress.Status).
+				Int("pages", progress.Pages).Int("messages", progress.MessagesReceived).Msg("backfill finished")
+			return
+		}
+
+		count := pageSize
+		if maxMessages > 0 && maxMessages-progress.MessagesReceived < count {
+			count = maxMessages - progress.MessagesReceived
+		}
+
+		received, err := l.requestBackfillPage(ctx, commandID, chatJID, anchor, count)
+		if errors.Is(err, errBackfillTimeout) && progress.Pages > 0 {
+			progress.Status = "reached_start"
+			continue
+		}
+		if err != nil {
+			l.db.MarkCommandFailed(ctx, commandID, err.Error())
+			return
+		}
+
+		progress.Pages++
+		progress.MessagesReceived += received
+		if received == 0 {
+			progress.Status = "reached_start"
+			continue
+		}
+
+		result, _ := json.Marshal(progress)
+		if err := l.db.UpdateCommandResult(ctx, commandID, result); err != nil {
+			log.Error().Err(err).Int64("command_id", commandID).Msg("failed to update backfill progress")
+		}
+		log.Info().Int64("command_id", commandID).Str("chat_id", chatID).
+			Int("pages", progress.Pages).Int("messages", progress.MessagesReceived).Msg("backfill page saved")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backfillPageDelay):
+		}
+	}
+}
+
+// requestBackfillPage sends one on-demand history request and waits for
+// HandleHistorySyncEvent to report how many messages it saved.
+func (l *Listener) requestBackfillPage(ctx context.Context, commandID int64, chatJID types.JID, anchor *store.MessageAnchor, count int) (int, error) {
+	chatKey := chatJID.String()
+	ps := &pendingSync{
+		commandID: commandID,
+		chatJID:   chatJID,
+		pages:     make(chan int, 1),
+	}
+
+	// Register the page before sending so a fast response finds it, but do
+	// not hold l.mu across the network round trip.
+	l.mu.Lock()
+	if _, exists := l.pendingSyncs[chatKey]; exists {
+		l.mu.Unlock()
+		return 0, fmt.Errorf("another history sync is already in progress for this chat")
+	}
+	ps.timer = time.AfterFunc(syncTimeout, func() {
+		l.mu.Lock()
+		if cur, exists := l.pendingSyncs[chatKey]; exists && cur == ps {
+			delete(l.pendingSyncs, chatKey)
+			ps.pages <- -1
+		}
+		l.mu.Unlock()
+	})
+	l.pendingSyncs[chatKey] = ps
+	l.mu.Unlock()
+
+	msgInfo := &types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     chatJID,
+			IsFromMe: anchor.IsFromMe,
+		},
+		ID:        types.MessageID(anchor.MessageID),
+		Timestamp: anchor.Timestamp,
+	}
+	if err := l.sendHistorySyncRequest(ctx, msgInfo, count); err != nil {
+		l.mu.Lock()
+		if cur, exists := l.pendingSyncs[chatKey]; exists && cur == ps {
+			delete(l.pendingSyncs, chatKey)
+			ps.timer.Stop()
+		}
+		l.mu.Unlock()
+		return 0, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case n := <-ps.pages:
+		if n < 0 {
+			return 0, errBackfillTimeout
+		}
+		return n, nil
+	}
+}
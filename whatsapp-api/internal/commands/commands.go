@@ -1,6 +1,10 @@
 // Package commands implements the LISTEN/NOTIFY pattern for bridge commands.
 // The frontend inserts rows into wa_bridge.bridge_commands; this package claims
-// and dispatches them. Currently supports the "history_sync" command type.
+// and dispatches them. Supported command types are "history_sync",
+// "backfill_chat", "retry_media", "edit_message", "revoke_message",
+// "send_reaction" and the group management commands "create_group",
+// "add_participants", "remove_participants", "set_group_name",
+// "set_group_description" and "get_invite_link".
 package commands
 
 import (
@@ -18,7 +22,9 @@ import (
 	"go.mau.fi/whatsmeow/types"
 	"go.mau.fi/whatsmeow/types/events"
 
+	"whatsapp-bridge/internal/config"
 	"whatsapp-bridge/internal/logging"
+	"whatsapp-bridge/internal/media"
 	"whatsapp-bridge/internal/store"
 )
 
@@ -26,11 +32,14 @@ var log = logging.Component("commands")
 
 const syncTimeout = 60 * time.Second
 
-// pendingSync tracks an in-flight history sync request.
+// pendingSync tracks an in-flight history sync request. For backfill pages,
+// pages receives the number of messages saved (or -1 on timeout) instead of
+// the command being completed directly.
 type pendingSync struct {
 	commandID int64
 	chatJID   types.JID
 	timer     *time.Timer
+	pages     chan int
 }
 
 // Listener processes bridge commands from the database.
@@ -38,18 +47,22 @@ type Listener struct {
 	client      *whatsmeow.Client
 	db          *store.Store
 	databaseURL string
+	media       *mediaDownloader
 
 	mu           sync.Mutex
 	pendingSyncs map[string]*pendingSync // keyed by chat JID string
+	backfills    map[string]int64        // running backfill_chat command IDs, keyed by chat JID string
 }
 
 // New creates a new commands Listener.
-func New(client *whatsmeow.Client, db *store.Store, databaseURL string) *Listener {
+func New(client *whatsmeow.Client, db *store.Store, cfg config.Config, pipeline *media.Pipeline) *Listener {
 	return &Listener{
 		client:       client,
 		db:           db,
-		databaseURL:  databaseURL,
+		databaseURL:  cfg.DatabaseURL,
+		media:        newMediaDownloader(db, cfg, pipeline),
 		pendingSyncs: make(map[string]*pendingSync),
+		backfills:    make(map[string]int64),
 	}
 }
 
@@ -70,6 +83,17 @@ func (l *Listener) Listen(ctx context.Context) {
 	}
 	log.Info().Msg("listening for bridge commands on bridge_command channel")
 
+	l.media.start(ctx)
+
+	// Recover commands stuck in 'processing' from a previous run. Only done
+	// at startup: after a reconnect, backfills may legitimately still be
+	// running.
+	if n, err := l.db.ResetStaleProcessingCommands(ctx); err != nil {
+		log.Error().Err(err).Msg("failed to reset stale processing commands")
+	} else if n > 0 {
+		log.Warn().Int64("count", n).Msg("reset stale processing commands from previous run")
+	}
+
 	l.processPending(ctx)
 
 	for {
@@ -96,13 +120,6 @@ func (l *Listener) Listen(ctx context.Context) {
 }
 
 func (l *Listener) processPending(ctx context.Context) {
-	// Recover commands stuck in 'processing' from a previous crash.
-	if n, err := l.db.ResetStaleProcessingCommands(ctx); err != nil {
-		log.Error().Err(err).Msg("failed to reset stale processing commands")
-	} else if n > 0 {
-		log.Warn().Int64("count", n).Msg("reset stale processing commands from previous crash")
-	}
-
 	ids, err := l.db.PendingCommandIDs(ctx)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to query pending commands")
@@ -131,6 +148,19 @@ func (l *Listener) processOne(ctx context.Context, id int64) {
 	switch cmd.CommandType {
 	case "history_sync":
 		l.handleHistorySync(ctx, cmd)
+	case "edit_message":
+		l.handleEditMessage(ctx, cmd)
+	case "revoke_message":
+		l.handleRevokeMessage(ctx, cmd)
+	case "send_reaction":
+		l.handleSendReaction(ctx, cmd)
+	case "backfill_chat":
+		l.handleBackfillChat(ctx, cmd)
+	case "retry_media":
+		l.handleRetryMedia(ctx, cmd)
+	case "create_group", "add_participants", "remove_participants",
+		"set_group_name", "set_group_description", "get_invite_link":
+		l.handleGroupCommand(ctx, cmd)
 	default:
 		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("unknown command type: %s", cmd.CommandType))
 	}
@@ -164,6 +194,11 @@ func (l *Listener) handleHistorySync(ctx context.Context, cmd *store.BridgeComma
 		l.db.MarkCommandFailed(ctx, cmd.ID, "another history sync is already in progress for this chat")
 		return
 	}
+	if _, exists := l.backfills[chatKey]; exists {
+		l.mu.Unlock()
+		l.db.MarkCommandFailed(ctx, cmd.ID, "a backfill is already in progress for this chat")
+		return
+	}
 
 	count := payload.Count
 	if count <= 0 {
@@ -204,22 +239,9 @@ func (l *Listener) handleHistorySync(ctx context.Context, cmd *store.BridgeComma
 		Timestamp: oldestTS,
 	}
 
-	historySyncMsg := l.client.BuildHistorySyncRequest(msgInfo, count)
-
-	// Send as a peer message to the phone (device 0), not the companion device.
-	ownID := l.client.Store.ID
-	if ownID == nil {
-		l.mu.Unlock()
-		l.db.MarkCommandFailed(ctx, cmd.ID, "not logged in to WhatsApp")
-		return
-	}
-	phoneJID := types.NewJID(ownID.User, types.DefaultUserServer)
-	phoneJID.Device = 0
-
-	_, err = l.client.SendMessage(ctx, phoneJID, historySyncMsg, whatsmeow.SendRequestExtra{Peer: true})
-	if err != nil {
+	if err := l.sendHistorySyncRequest(ctx, msgInfo, count); err != nil {
 		l.mu.Unlock()
-		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("failed to send history sync request: %v", err))
+		l.db.MarkCommandFailed(ctx, cmd.ID, err.Error())
 		return
 	}
 
@@ -251,9 +273,29 @@ func (l *Listener) handleHistorySync(ctx context.Context, cmd *store.BridgeComma
 		Msg("history sync request sent, waiting for response")
 }
 
+// sendHistorySyncRequest asks the phone for up to count messages older than
+// the anchor message.
+func (l *Listener) sendHistorySyncRequest(ctx context.Context, anchor *types.MessageInfo, count int) error {
+	historySyncMsg := l.client.BuildHistorySyncRequest(anchor, count)
+
+	// Send as a peer message to the phone (device 0), not the companion device.
+	ownID := l.client.Store.ID
+	if ownID == nil {
+		return fmt.Errorf("not logged in to WhatsApp")
+	}
+	phoneJID := types.NewJID(ownID.User, types.DefaultUserServer)
+	phoneJID.Device = 0
+
+	if _, err := l.client.SendMessage(ctx, phoneJID, historySyncMsg, whatsmeow.SendRequestExtra{Peer: true}); err != nil {
+		return fmt.Errorf("failed to send history sync request: %v", err)
+	}
+	return nil
+}
+
 // HandleHistorySyncEvent is called from the event handler when an
-// events.HistorySync event arrives. It matches ON_DEMAND syncs to pending
-// commands, saves the messages, and marks the command as completed.
+// events.HistorySync event arrives. ON_DEMAND syncs are matched to pending
+// history_sync commands; every other sync type (the bootstrap, recent and
+// full syncs sent after pairing, and push names) is ingested in full.
 func (l *Listener) HandleHistorySyncEvent(evt *events.HistorySync) {
 	data := evt.Data
 	if data == nil {
@@ -261,13 +303,22 @@ func (l *Listener) HandleHistorySyncEvent(evt *events.HistorySync) {
 	}
 
 	syncType := data.GetSyncType()
-	log.Info().Str("sync_type", syncType.String()).Int("conversations", len(data.GetConversations())).Msg("history sync event received")
+	log.Info().Str("sync_type", syncType.String()).Int("conversations", len(data.GetConversations())).
+		Uint32("chunk", data.GetChunkOrder()).Uint32("progress", data.GetProgress()).Msg("history sync event received")
 
-	// We only handle ON_DEMAND syncs triggered by our commands.
 	if syncType != waHistorySync.HistorySync_ON_DEMAND {
+		l.ingestHistorySync(data)
 		return
 	}
 
+	messages := l.handleOnDemandSync(data)
+	l.recordHistorySyncChunk(data, len(data.GetConversations()), messages, 0)
+}
+
+// handleOnDemandSync saves the messages of an ON_DEMAND sync and completes
+// the history_sync commands waiting for them. Returns the number of
+// messages saved.
+func (l *Listener) handleOnDemandSync(data *waHistorySync.HistorySync) int {
 	totalSaved := 0
 	for _, conv := range data.GetConversations() {
 		chatID := conv.GetID()
@@ -275,14 +326,8 @@ func (l *Listener) HandleHistorySyncEvent(evt *events.HistorySync) {
 			continue
 		}
 
-		// Resolve @lid to @s.whatsapp.net so history messages share
-		// the same chat_id as live messages.
 		originalChatID := chatID
-		if chatJID, err := types.ParseJID(chatID); err == nil && chatJID.Server == types.HiddenUserServer {
-			if pnJID, err := l.client.Store.LIDs.GetPNForLID(context.Background(), chatJID); err == nil && !pnJID.IsEmpty() {
-				chatID = pnJID.String()
-			}
-		}
+		chatID = l.resolveHistoryChatID(chatID)
 
 		// Find the pending sync for this chat. Try the resolved ID first,
 		// then fall back to the original in case the command used @lid.
@@ -301,27 +346,16 @@ func (l *Listener) HandleHistorySyncEvent(evt *events.HistorySync) {
 		l.mu.Unlock()
 
 		// Process messages even if no pending sync found (better to save them).
-		msgCount := 0
-		for _, hsMsg := range conv.GetMessages() {
-			webMsg := hsMsg.GetMessage()
-			if webMsg == nil || webMsg.GetKey() == nil {
-				continue
-			}
-
-			payload := convertHistoryMessage(chatID, webMsg)
-			if payload == nil {
-				continue
-			}
-
-			l.db.SaveMessage(*payload)
-			msgCount++
-		}
+		msgCount := l.saveHistoryMessages(chatID, conv)
 
 		totalSaved += msgCount
 		log.Info().Str("chat_id", chatID).Int("messages", msgCount).Msg("history sync messages saved")
 
-		// Mark the command as completed if we had a pending sync.
-		if exists {
+		// Mark the command as completed if we had a pending sync, or hand the
+		// page over to its backfill job.
+		if exists && ps.pages != nil {
+			ps.pages <- msgCount
+		} else if exists {
 			result, _ := json.Marshal(map[string]int{"messages_received": msgCount})
 			if err := l.db.MarkCommandCompleted(context.Background(), ps.commandID, result); err != nil {
 				log.Error().Err(err).Int64("command_id", ps.commandID).Msg("failed to mark command completed")
@@ -342,6 +376,10 @@ func (l *Listener) HandleHistorySyncEvent(evt *events.HistorySync) {
 				if convID != "" && (convID == chatKey || strings.HasPrefix(convID, chatKey) || strings.HasPrefix(chatKey, convID)) {
 					ps.timer.Stop()
 					delete(l.pendingSyncs, chatKey)
+					if ps.pages != nil {
+						ps.pages <- 0
+						break
+					}
 					result, _ := json.Marshal(map[string]int{"messages_received": 0})
 					_ = l.db.MarkCommandCompleted(context.Background(), ps.commandID, result)
 					break
@@ -350,4 +388,5 @@ func (l *Listener) HandleHistorySyncEvent(evt *events.HistorySync) {
 		}
 		l.mu.Unlock()
 	}
+	return totalSaved
 }
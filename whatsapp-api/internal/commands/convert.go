@@ -5,8 +5,12 @@ import (
 	"time"
 
 	"go.mau.fi/whatsmeow/proto/waWeb"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
 
+	"whatsapp-bridge/internal/media"
 	"whatsapp-bridge/internal/store"
+	"whatsapp-bridge/internal/wamsg"
 )
 
 // convertHistoryMessage converts a whatsmeow WebMessageInfo (from a history
@@ -18,27 +22,34 @@ func convertHistoryMessage(chatID string, webMsg *waWeb.WebMessageInfo) *store.M
 		return nil
 	}
 
-	msg := webMsg.GetMessage()
-	if msg == nil {
+	if webMsg.GetMessage() == nil {
 		return nil
 	}
+	// Unwrap view-once, ephemeral and other containers the same way whatsmeow
+	// does for live messages.
+	evt := (&events.Message{RawMessage: webMsg.GetMessage()}).UnwrapRaw()
+	msg := evt.Message
 
 	isFromMe := key.GetFromMe()
 	isGroup := strings.HasSuffix(chatID, "@g.us")
 
 	// Determine sender.
-	var senderID string
+	var senderID, senderJID string
 	if isGroup {
 		// In groups, participant contains the sender JID.
-		if p := webMsg.GetParticipant(); p != "" {
-			senderID = extractUser(p)
-		} else if key.GetParticipant() != "" {
-			senderID = extractUser(key.GetParticipant())
+		senderJID = webMsg.GetParticipant()
+		if senderJID == "" {
+			senderJID = key.GetParticipant()
 		}
+		senderID = extractUser(senderJID)
 	} else if !isFromMe {
 		// In 1:1 chats, the sender is the remote JID.
+		senderJID = chatID
 		senderID = extractUser(chatID)
 	}
+	if jid, err := types.ParseJID(senderJID); err == nil {
+		senderJID = jid.ToNonAD().String()
+	}
 
 	ts := time.Unix(int64(webMsg.GetMessageTimestamp()), 0)
 	pushName := webMsg.GetPushName()
@@ -48,9 +59,12 @@ func convertHistoryMessage(chatID string, webMsg *waWeb.WebMessageInfo) *store.M
 		MessageID:   key.GetID(),
 		ChatID:      chatID,
 		SenderID:    senderID,
+		SenderJID:   senderJID,
 		SenderName:  pushName,
 		IsGroup:     isGroup,
 		IsFromMe:    isFromMe,
+		IsViewOnce:  evt.IsViewOnce,
+		IsEphemeral: evt.IsEphemeral,
 	}
 
 	// Extract content following the same switch/case as messaging/handler.go:buildPayload()
@@ -95,15 +109,76 @@ func convertHistoryMessage(chatID string, webMsg *waWeb.WebMessageInfo) *store.M
 			names = append(names, c.GetDisplayName())
 		}
 		payload.Text = strings.Join(names, ", ")
+	case msg.LocationMessage != nil:
+		loc := msg.LocationMessage
+		payload.MessageType = "location"
+		payload.Location = &store.Location{
+			Latitude:  loc.GetDegreesLatitude(),
+			Longitude: loc.GetDegreesLongitude(),
+			Name:      loc.GetName(),
+			Address:   loc.GetAddress(),
+			IsLive:    loc.GetIsLive(),
+		}
+		payload.Text = payload.Location.Text()
+		payload.ReplyToMessageID = loc.GetContextInfo().GetStanzaID()
+	case msg.LiveLocationMessage != nil:
+		loc := msg.LiveLocationMessage
+		payload.MessageType = "location"
+		payload.Location = &store.Location{
+			Latitude:  loc.GetDegreesLatitude(),
+			Longitude: loc.GetDegreesLongitude(),
+			Name:      loc.GetCaption(),
+			IsLive:    true,
+		}
+		payload.Text = payload.Location.Text()
+		payload.ReplyToMessageID = loc.GetContextInfo().GetStanzaID()
+	case msg.ButtonsResponseMessage != nil:
+		r := msg.ButtonsResponseMessage
+		payload.MessageType = "text"
+		payload.Text = r.GetSelectedDisplayText()
+		payload.Selection = &store.Selection{Type: "button", ID: r.GetSelectedButtonID(), Title: r.GetSelectedDisplayText()}
+		payload.ReplyToMessageID = r.GetContextInfo().GetStanzaID()
+	case msg.ListResponseMessage != nil:
+		r := msg.ListResponseMessage
+		payload.MessageType = "text"
+		payload.Text = r.GetTitle()
+		payload.Selection = &store.Selection{Type: "list", ID: r.GetSingleSelectReply().GetSelectedRowID(), Title: r.GetTitle()}
+		payload.ReplyToMessageID = r.GetContextInfo().GetStanzaID()
+	case msg.TemplateButtonReplyMessage != nil:
+		r := msg.TemplateButtonReplyMessage
+		payload.MessageType = "text"
+		payload.Text = r.GetSelectedDisplayText()
+		payload.Selection = &store.Selection{Type: "template_button", ID: r.GetSelectedID(), Title: r.GetSelectedDisplayText()}
+		payload.ReplyToMessageID = r.GetContextInfo().GetStanzaID()
+	case msg.InteractiveResponseMessage != nil:
+		r := msg.InteractiveResponseMessage
+		payload.MessageType = "text"
+		payload.Text = r.GetBody().GetText()
+		payload.Selection = store.NativeFlowSelection(r.GetBody().GetText(), r.GetNativeFlowResponseMessage().GetParamsJSON())
+		payload.ReplyToMessageID = r.GetContextInfo().GetStanzaID()
+	case wamsg.PollCreation(msg) != nil:
+		pc := wamsg.PollCreation(msg)
+		payload.MessageType = "poll"
+		payload.Poll = wamsg.Poll(pc)
+		payload.Text = pc.GetName()
+		payload.ReplyToMessageID = pc.GetContextInfo().GetStanzaID()
 	default:
-		// Skip protocol messages, sender key distributions, etc.
+		// Skip protocol messages, sender key distributions, poll votes, etc.
 		// These are internal events, not user-visible content.
-		if msg.GetProtocolMessage() != nil || msg.GetSenderKeyDistributionMessage() != nil {
+		if msg.GetProtocolMessage() != nil || msg.GetSenderKeyDistributionMessage() != nil || msg.GetPollUpdateMessage() != nil {
 			return nil
 		}
 		payload.MessageType = "other"
 	}
 
+	if payload.MessageType == "media" {
+		if info := media.FromProto(msg); info != nil {
+			keys, meta := info.Keys(), info.Meta()
+			payload.MediaKeys = &keys
+			payload.Media = &meta
+		}
+	}
+
 	return &payload
 }
 
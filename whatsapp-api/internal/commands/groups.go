@@ -0,0 +1,248 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-bridge/internal/store"
+	"whatsapp-bridge/internal/waclient"
+)
+
+// groupPayload is the expected JSON shape for the group management commands.
+// Which fields are used depends on the command type.
+type groupPayload struct {
+	Name         string   `json:"name"`
+	Description  string   `json:"description"`
+	Participants []string `json:"participants"`
+	Reset        bool     `json:"reset"`
+}
+
+// participantResult reports the outcome for one participant of a
+// create_group, add_participants or remove_participants command. Error is the
+// WhatsApp error code, e.g. 403 when the user's privacy settings only allow
+// being added through an invite link.
+type participantResult struct {
+	ParticipantID string `json:"participant_id"`
+	Error         int    `json:"error,omitempty"`
+}
+
+// handleGroupCommand dispatches the group management commands. All except
+// create_group operate on the group in cmd.ChatID.
+func (l *Listener) handleGroupCommand(ctx context.Context, cmd *store.BridgeCommand) {
+	var payload groupPayload
+	if err := json.Unmarshal(cmd.Payload, &payload); err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("invalid payload: %v", err))
+		return
+	}
+
+	var result interface{}
+	var err error
+	if cmd.CommandType == "create_group" {
+		result, err = l.createGroup(ctx, payload)
+	} else {
+		var groupJID types.JID
+		groupJID, err = types.ParseJID(cmd.ChatID)
+		if err != nil {
+			l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("invalid chat_id JID: %v", err))
+			return
+		}
+		if groupJID.Server != types.GroupServer {
+			l.db.MarkCommandFailed(ctx, cmd.ID, "chat_id is not a group")
+			return
+		}
+
+		switch cmd.CommandType {
+		case "add_participants":
+			result, err = l.updateParticipants(ctx, groupJID, payload.Participants, whatsmeow.ParticipantChangeAdd)
+		case "remove_participants":
+			result, err = l.updateParticipants(ctx, groupJID, payload.Participants, whatsmeow.ParticipantChangeRemove)
+		case "set_group_name":
+			result, err = l.setGroupName(ctx, groupJID, payload.Name)
+		case "set_group_description":
+			result, err = l.setGroupDescription(ctx, groupJID, payload.Description)
+		case "get_invite_link":
+			result, err = l.getInviteLink(ctx, groupJID, payload.Reset)
+		}
+	}
+	if err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, err.Error())
+		return
+	}
+
+	raw, _ := json.Marshal(result)
+	if err := l.db.MarkCommandCompleted(ctx, cmd.ID, raw); err != nil {
+		log.Error().Err(err).Int64("command_id", cmd.ID).Msg("failed to mark command completed")
+	}
+}
+
+// createGroup creates a group with us as admin, stores its chat and member
+// rows right away and returns the new group's chat_id and invite link.
+func (l *Listener) createGroup(ctx context.Context, payload groupPayload) (map[string]interface{}, error) {
+	if payload.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	participants, err := parseParticipants(payload.Participants)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := l.client.CreateGroup(ctx, whatsmeow.ReqCreateGroup{
+		Name:         payload.Name,
+		Participants: participants,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create group: %v", err)
+	}
+	chatID := info.JID.String()
+
+	if payload.Description != "" {
+		if err := l.client.SetGroupTopic(ctx, info.JID, "", "", payload.Description); err != nil {
+			log.Error().Err(err).Str("chat_id", chatID).Msg("failed to set description of new group")
+		} else {
+			info.Topic = payload.Description
+		}
+	}
+
+	if err := l.db.UpsertGroupChat(ctx, chatID, info.Name, info.Topic, true); err != nil {
+		return nil, fmt.Errorf("group %s created but failed to store chat: %v", chatID, err)
+	}
+
+	var members []store.GroupParticipant
+	var results []participantResult
+	for _, p := range info.Participants {
+		id := waclient.ParticipantID(ctx, l.client, p.JID, p.PhoneNumber)
+		if p.Error != 0 {
+			results = append(results, participantResult{ParticipantID: id, Error: p.Error})
+			continue
+		}
+		members = append(members, store.GroupParticipant{
+			ID:           id,
+			IsAdmin:      p.IsAdmin || p.IsSuperAdmin,
+			IsSuperAdmin: p.IsSuperAdmin,
+		})
+		results = append(results, participantResult{ParticipantID: id})
+	}
+	if err := l.db.SyncGroupParticipants(ctx, chatID, members, time.Now()); err != nil {
+		log.Error().Err(err).Str("chat_id", chatID).Msg("failed to store participants of new group")
+	}
+
+	result := map[string]interface{}{
+		"chat_id":      chatID,
+		"name":         info.Name,
+		"participants": results,
+	}
+	// The link lets travelers whose privacy settings blocked the add join
+	// on their own.
+	if link, err := l.client.GetGroupInviteLink(ctx, info.JID, false); err != nil {
+		log.Error().Err(err).Str("chat_id", chatID).Msg("failed to get invite link of new group")
+	} else {
+		result["invite_link"] = link
+	}
+
+	log.Info().Str("chat_id", chatID).Str("name", info.Name).Int("participants", len(members)).Msg("group created")
+	return result, nil
+}
+
+func (l *Listener) updateParticipants(ctx context.Context, groupJID types.JID, numbers []string, action whatsmeow.ParticipantChange) (map[string]interface{}, error) {
+	participants, err := parseParticipants(numbers)
+	if err != nil {
+		return nil, err
+	}
+	if len(participants) == 0 {
+		return nil, fmt.Errorf("participants is required")
+	}
+
+	changed, err := l.client.UpdateGroupParticipants(ctx, groupJID, participants, action)
+	if err != nil {
+		return nil, fmt.Errorf("failed to %s participants: %v", action, err)
+	}
+
+	change := "join"
+	if action == whatsmeow.ParticipantChangeRemove {
+		change = "leave"
+	}
+
+	var ok []string
+	results := make([]participantResult, 0, len(changed))
+	for _, p := range changed {
+		id := waclient.ParticipantID(ctx, l.client, p.JID, p.PhoneNumber)
+		results = append(results, participantResult{ParticipantID: id, Error: p.Error})
+		if p.Error == 0 {
+			ok = append(ok, id)
+		}
+	}
+	if len(ok) > 0 {
+		chatID := groupJID.String()
+		if err := l.db.UpsertGroupChat(ctx, chatID, "", "", false); err != nil {
+			log.Error().Err(err).Str("chat_id", chatID).Msg("failed to ensure group chat")
+		} else if err := l.db.ApplyGroupParticipantChange(ctx, chatID, ok, change, time.Now()); err != nil {
+			log.Error().Err(err).Str("chat_id", chatID).Str("change", change).Msg("failed to store participant change")
+		}
+	}
+
+	log.Info().Str("chat_id", groupJID.String()).Str("action", string(action)).Int("changed", len(ok)).Msg("group participants updated")
+	return map[string]interface{}{"participants": results}, nil
+}
+
+func (l *Listener) setGroupName(ctx context.Context, groupJID types.JID, name string) (map[string]interface{}, error) {
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if err := l.client.SetGroupName(ctx, groupJID, name); err != nil {
+		return nil, fmt.Errorf("failed to set group name: %v", err)
+	}
+	if err := l.db.UpsertGroupChat(ctx, groupJID.String(), name, "", false); err != nil {
+		log.Error().Err(err).Str("chat_id", groupJID.String()).Msg("failed to store group name")
+	}
+	return map[string]interface{}{"name": name}, nil
+}
+
+// setGroupDescription sets the group topic; an empty description clears it.
+func (l *Listener) setGroupDescription(ctx context.Context, groupJID types.JID, description string) (map[string]interface{}, error) {
+	if err := l.client.SetGroupTopic(ctx, groupJID, "", "", description); err != nil {
+		return nil, fmt.Errorf("failed to set group description: %v", err)
+	}
+	if err := l.db.UpsertGroupChat(ctx, groupJID.String(), "", description, true); err != nil {
+		log.Error().Err(err).Str("chat_id", groupJID.String()).Msg("failed to store group description")
+	}
+	return map[string]interface{}{"description": description}, nil
+}
+
+// getInviteLink returns the group's invite link, revoking the old one first
+// when reset is set.
+func (l *Listener) getInviteLink(ctx context.Context, groupJID types.JID, reset bool) (map[string]interface{}, error) {
+	link, err := l.client.GetGroupInviteLink(ctx, groupJID, reset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invite link: %v", err)
+	}
+	return map[string]interface{}{"invite_link": link}, nil
+}
+
+// parseParticipants accepts phone numbers (optionally with a leading "+") or
+// full JIDs.
+func parseParticipants(numbers []string) ([]types.JID, error) {
+	jids := make([]types.JID, 0, len(numbers))
+	for _, n := range numbers {
+		n = strings.TrimSpace(n)
+		if strings.Contains(n, "@") {
+			jid, err := types.ParseJID(n)
+			if err != nil {
+				return nil, fmt.Errorf("invalid participant %q: %v", n, err)
+			}
+			jids = append(jids, jid)
+			continue
+		}
+		n = strings.TrimPrefix(n, "+")
+		if n == "" {
+			return nil, fmt.Errorf("empty participant number")
+		}
+		jids = append(jids, types.NewJID(n, types.DefaultUserServer))
+	}
+	return jids, nil
+}
@@ -0,0 +1,45 @@
+package commands
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+)
+
+func TestParseParticipants(t *testing.T) {
+	got, err := parseParticipants([]string{
+		"5511999999999",
+		" +5511888888888 ",
+		"5511777777777@s.whatsapp.net",
+		"123456789@lid",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []types.JID{
+		types.NewJID("5511999999999", types.DefaultUserServer),
+		types.NewJID("5511888888888", types.DefaultUserServer),
+		types.NewJID("5511777777777", types.DefaultUserServer),
+		types.NewJID("123456789", types.HiddenUserServer),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseParticipants returned %d JIDs, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("participant %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseParticipantsInvalid(t *testing.T) {
+	for _, numbers := range [][]string{
+		{""},
+		{"+"},
+		{"5511999999999", "  "},
+	} {
+		if _, err := parseParticipants(numbers); err == nil {
+			t.Errorf("parseParticipants(%q) succeeded, want error", numbers)
+		}
+	}
+}
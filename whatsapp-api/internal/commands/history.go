@@ -0,0 +1,163 @@
+package commands
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/store"
+)
+
+// mutedForever stands in for WhatsApp's "always" mute, which history syncs
+// encode as -1.
+var mutedForever = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+
+// ingestHistorySync persists a non-ON_DEMAND history sync chunk: chat state,
+// messages and push names. These arrive in bulk right after pairing, so a
+// freshly linked bridge starts with the phone's existing chats.
+func (l *Listener) ingestHistorySync(data *waHistorySync.HistorySync) {
+	ctx := context.Background()
+	syncType := data.GetSyncType().String()
+
+	conversations, messages := 0, 0
+	for _, conv := range data.GetConversations() {
+		chatID := conv.GetID()
+		if chatID == "" || strings.HasSuffix(chatID, "@broadcast") {
+			continue
+		}
+		chatID = l.resolveHistoryChatID(chatID)
+
+		if err := l.db.SaveHistoryConversation(ctx, historyConversation(chatID, conv)); err != nil {
+			log.Error().Err(err).Str("chat_id", chatID).Msg("failed to save history conversation")
+			continue
+		}
+		conversations++
+		messages += l.saveHistoryMessages(chatID, conv)
+	}
+
+	pushNames := 0
+	for _, pn := range data.GetPushnames() {
+		jid, err := types.ParseJID(pn.GetID())
+		if err != nil || pn.GetPushname() == "" || pn.GetPushname() == "-" {
+			continue
+		}
+		if jid.Server == types.HiddenUserServer {
+			resolved, err := l.client.Store.LIDs.GetPNForLID(ctx, jid)
+			if err != nil || resolved.IsEmpty() {
+				continue
+			}
+			jid = resolved
+		}
+		if jid.Server != types.DefaultUserServer {
+			continue
+		}
+		if err := l.db.SavePushName(ctx, jid.User, pn.GetPushname()); err != nil {
+			log.Error().Err(err).Str("phone", jid.User).Msg("failed to save push name")
+			continue
+		}
+		pushNames++
+	}
+
+	metrics.HistorySyncItemsTotal.WithLabelValues(syncType, "conversation").Add(float64(conversations))
+	metrics.HistorySyncItemsTotal.WithLabelValues(syncType, "push_name").Add(float64(pushNames))
+	l.recordHistorySyncChunk(data, conversations, messages, pushNames)
+
+	log.Info().
+		Str("sync_type", syncType).
+		Uint32("progress", data.GetProgress()).
+		Int("conversations", conversations).
+		Int("messages", messages).
+		Int("push_names", pushNames).
+		Msg("history sync chunk saved")
+}
+
+// historyConversation maps a history sync conversation onto the chat state
+// we keep.
+func historyConversation(chatID string, conv *waHistorySync.Conversation) store.HistoryConversation {
+	hc := store.HistoryConversation{
+		ChatID:         chatID,
+		IsGroup:        strings.HasSuffix(chatID, "@g.us"),
+		Name:           conv.GetName(),
+		IsArchived:     conv.GetArchived(),
+		UnreadCount:    int(conv.GetUnreadCount()),
+		IsMarkedUnread: conv.GetMarkedAsUnread(),
+	}
+	if hc.Name == "" {
+		hc.Name = conv.GetDisplayName()
+	}
+	if ts := conv.GetLastMsgTimestamp(); ts > 0 {
+		hc.LastMessageAt = time.Unix(int64(ts), 0)
+	} else if ts := conv.GetConversationTimestamp(); ts > 0 {
+		hc.LastMessageAt = time.Unix(int64(ts), 0)
+	}
+	if ts := conv.GetPinned(); ts > 0 {
+		hc.PinnedAt = time.Unix(int64(ts), 0)
+	}
+	if end := int64(conv.GetMuteEndTime()); end < 0 {
+		hc.MutedUntil = mutedForever
+	} else if end > 0 {
+		hc.MutedUntil = time.Unix(end, 0)
+	}
+	return hc
+}
+
+// resolveHistoryChatID resolves @lid to @s.whatsapp.net so history messages
+// share the same chat_id as live messages.
+func (l *Listener) resolveHistoryChatID(chatID string) string {
+	if chatJID, err := types.ParseJID(chatID); err == nil && chatJID.Server == types.HiddenUserServer {
+		if pnJID, err := l.client.Store.LIDs.GetPNForLID(context.Background(), chatJID); err == nil && !pnJID.IsEmpty() {
+			return pnJID.String()
+		}
+	}
+	return chatID
+}
+
+// saveHistoryMessages stores the messages of one history sync conversation
+// and returns how many were saved.
+func (l *Listener) saveHistoryMessages(chatID string, conv *waHistorySync.Conversation) int {
+	msgCount := 0
+	for _, hsMsg := range conv.GetMessages() {
+		webMsg := hsMsg.GetMessage()
+		if webMsg == nil || webMsg.GetKey() == nil {
+			continue
+		}
+
+		payload := convertHistoryMessage(chatID, webMsg)
+		if payload == nil {
+			continue
+		}
+
+		l.db.SaveMessage(*payload)
+		msgCount++
+
+		if payload.MessageType == "media" {
+			l.queueHistoryMedia(payload)
+		}
+	}
+	return msgCount
+}
+
+// recordHistorySyncChunk updates the metrics and the sync's row in
+// wa_bridge.history_sync_status.
+func (l *Listener) recordHistorySyncChunk(data *waHistorySync.HistorySync, conversations, messages, pushNames int) {
+	syncType := data.GetSyncType().String()
+	metrics.HistorySyncChunkTotal.WithLabelValues(syncType).Inc()
+	metrics.HistorySyncItemsTotal.WithLabelValues(syncType, "message").Add(float64(messages))
+	metrics.HistorySyncProgress.WithLabelValues(syncType).Set(float64(data.GetProgress()))
+
+	if err := l.db.RecordHistorySyncChunk(context.Background(), syncType, int(data.GetProgress()), conversations, messages, pushNames); err != nil {
+		log.Error().Err(err).Str("sync_type", syncType).Msg("failed to record history sync status")
+	}
+}
+
+// queueHistoryMedia hands a saved history message's attachment to the media
+// downloader.
+func (l *Listener) queueHistoryMedia(payload *store.MessagePayload) {
+	if target, ok := payload.MediaTarget(); ok {
+		l.media.enqueue(target)
+	}
+}
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"testing"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waHistorySync"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-bridge/internal/store"
+)
+
+func TestHistoryConversation(t *testing.T) {
+	tests := []struct {
+		name   string
+		chatID string
+		conv   *waHistorySync.Conversation
+		want   store.HistoryConversation
+	}{
+		{
+			name:   "empty",
+			chatID: "5511999999999@s.whatsapp.net",
+			conv:   &waHistorySync.Conversation{},
+			want:   store.HistoryConversation{ChatID: "5511999999999@s.whatsapp.net"},
+		},
+		{
+			name:   "group state",
+			chatID: "120363000000000000@g.us",
+			conv: &waHistorySync.Conversation{
+				Name:             proto.String("Sales"),
+				DisplayName:      proto.String("ignored"),
+				Archived:         proto.Bool(true),
+				UnreadCount:      proto.Uint32(3),
+				MarkedAsUnread:   proto.Bool(true),
+				LastMsgTimestamp: proto.Uint64(1700000000),
+				Pinned:           proto.Uint32(1700000100),
+				MuteEndTime:      proto.Uint64(1700000200),
+			},
+			want: store.HistoryConversation{
+				ChatID:         "120363000000000000@g.us",
+				IsGroup:        true,
+				Name:           "Sales",
+				IsArchived:     true,
+				UnreadCount:    3,
+				IsMarkedUnread: true,
+				LastMessageAt:  time.Unix(1700000000, 0),
+				PinnedAt:       time.Unix(1700000100, 0),
+				MutedUntil:     time.Unix(1700000200, 0),
+			},
+		},
+		{
+			name:   "fallbacks",
+			chatID: "5511999999999@s.whatsapp.net",
+			conv: &waHistorySync.Conversation{
+				DisplayName:           proto.String("Maria"),
+				ConversationTimestamp: proto.Uint64(1700000000),
+			},
+			want: store.HistoryConversation{
+				ChatID:        "5511999999999@s.whatsapp.net",
+				Name:          "Maria",
+				LastMessageAt: time.Unix(1700000000, 0),
+			},
+		},
+		{
+			name:   "muted forever",
+			chatID: "5511999999999@s.whatsapp.net",
+			conv:   &waHistorySync.Conversation{MuteEndTime: proto.Uint64(1<<64 - 1)},
+			want: store.HistoryConversation{
+				ChatID:     "5511999999999@s.whatsapp.net",
+				MutedUntil: mutedForever,
+			},
+		},
+	}
+	for _, tt := range tests {
+		if got := historyConversation(tt.chatID, tt.conv); got != tt.want {
+			t.Errorf("%s: historyConversation() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
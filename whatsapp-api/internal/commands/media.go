@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"whatsapp-bridge/internal/config"
+	"whatsapp-bridge/internal/media"
+	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/store"
+)
+
+const (
+	mediaQueueSize     = 1000
+	mediaSweepInterval = 10 * time.Minute
+	mediaSweepBatch    = 100
+)
+
+// mediaDownloader fetches attachments that were not stored when their
+// message arrived: media from history syncs, failed downloads picked up by
+// the periodic sweep, and retry_media commands. A fixed number of workers
+// keeps a large sync from flooding WhatsApp's CDN.
+type mediaDownloader struct {
+	db          *store.Store
+	pipeline    *media.Pipeline
+	concurrency int
+	maxAttempts int
+	jobs        chan store.MediaTarget
+	stop        chan struct{} // closed once the workers have stopped
+
+	mu     sync.Mutex
+	queued map[string]bool // chat_id/message_id of queued or running jobs
+}
+
+func newMediaDownloader(db *store.Store, cfg config.Config, pipeline *media.Pipeline) *mediaDownloader {
+	return &mediaDownloader{
+		db:          db,
+		pipeline:    pipeline,
+		concurrency: cfg.HistoryMediaConcurrency,
+		maxAttempts: cfg.MediaRetryMaxAttempts,
+		jobs:        make(chan store.MediaTarget, mediaQueueSize),
+		stop:        make(chan struct{}),
+		queued:      make(map[string]bool),
+	}
+}
+
+// start launches the download workers and the retry sweep. They stop when
+// ctx is cancelled.
+func (d *mediaDownloader) start(ctx context.Context) {
+	if d.pipeline.Storage() == nil {
+		return
+	}
+	for i := 0; i < d.concurrency; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case t := <-d.jobs:
+					if _, err := d.fetch(ctx, t); errors.Is(err, media.ErrTooLarge) {
+						metrics.HistoryMediaTotal.WithLabelValues("too_large").Inc()
+					} else if err != nil {
+						metrics.HistoryMediaTotal.WithLabelValues("failed").Inc()
+						log.Error().Err(err).Str("chat_id", t.ChatID).Str("message_id", t.MessageID).Msg("failed to fetch media")
+					}
+					d.done(t)
+					metrics.HistoryMediaQueueDepth.Set(float64(len(d.jobs)))
+				}
+			}
+		}()
+	}
+	go d.sweep(ctx)
+	go func() {
+		<-ctx.Done()
+		close(d.stop)
+	}()
+}
+
+// enqueue queues an attachment for download unless it is already queued. It
+// blocks when the queue is full, which slows history ingestion down to the
+// download rate, and gives up once the workers have stopped. A no-op when
+// media storage is not configured.
+func (d *mediaDownloader) enqueue(t store.MediaTarget) {
+	if d.pipeline.Storage() == nil {
+		return
+	}
+	key := t.ChatID + "/" + t.MessageID
+	d.mu.Lock()
+	if d.queued[key] {
+		d.mu.Unlock()
+		return
+	}
+	d.queued[key] = true
+	d.mu.Unlock()
+
+	select {
+	case d.jobs <- t:
+		metrics.HistoryMediaQueueDepth.Set(float64(len(d.jobs)))
+	case <-d.stop:
+		d.done(t)
+	}
+}
+
+func (d *mediaDownloader) done(t store.MediaTarget) {
+	d.mu.Lock()
+	delete(d.queued, t.ChatID+"/"+t.MessageID)
+	d.mu.Unlock()
+}
+
+// sweep periodically re-queues media whose download or upload failed, with
+// a backoff per attempt, up to the configured number of attempts.
+func (d *mediaDownloader) sweep(ctx context.Context) {
+	ticker := time.NewTicker(mediaSweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		targets, err := d.db.MediaRetryCandidates(ctx, d.maxAttempts, mediaSweepBatch)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to query media retry candidates")
+			continue
+		}
+		for _, t := range targets {
+			d.enqueue(t)
+		}
+		if len(targets) > 0 {
+			log.Info().Int("count", len(targets)).Msg("queued missing media for retry")
+		}
+	}
+}
+
+// fetch stores an attachment through the media pipeline unless it was
+// stored since the job was queued.
+func (d *mediaDownloader) fetch(ctx context.Context, t store.MediaTarget) (string, error) {
+	if path, err := d.db.MediaPath(ctx, t.ChatID, t.MessageID); err != nil {
+		return "", fmt.Errorf("failed to check media_path: %w", err)
+	} else if path != "" {
+		metrics.HistoryMediaTotal.WithLabelValues("skipped").Inc()
+		return path, nil
+	}
+	path, err := d.pipeline.Fetch(ctx, t, nil)
+	if err != nil {
+		return "", err
+	}
+	metrics.HistoryMediaTotal.WithLabelValues("stored").Inc()
+	return path, nil
+}
+
+// retryMediaPayload is the expected JSON shape for retry_media commands.
+type retryMediaPayload struct {
+	MessageID string `json:"message_id"`
+}
+
+// handleRetryMedia downloads a message's attachment again right away,
+// regardless of previous attempts. Runs in the background since a re-upload
+// request to the phone can take up to a minute.
+func (l *Listener) handleRetryMedia(ctx context.Context, cmd *store.BridgeCommand) {
+	var payload retryMediaPayload
+	if err := json.Unmarshal(cmd.Payload, &payload); err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("invalid payload: %v", err))
+		return
+	}
+	if payload.MessageID == "" {
+		l.db.MarkCommandFailed(ctx, cmd.ID, "message_id is required")
+		return
+	}
+	if l.media.pipeline.Storage() == nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, "media storage is not configured")
+		return
+	}
+
+	target, err := l.db.GetMediaTarget(ctx, cmd.ChatID, payload.MessageID)
+	if err == sql.ErrNoRows {
+		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("no media key material stored for message %s", payload.MessageID))
+		return
+	} else if err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("failed to look up message: %v", err))
+		return
+	}
+
+	go func() {
+		mediaPath, err := l.media.fetch(ctx, *target)
+		if err != nil {
+			l.db.MarkCommandFailed(ctx, cmd.ID, err.Error())
+			return
+		}
+		result, _ := json.Marshal(map[string]string{
+			"message_id": payload.MessageID,
+			"media_path": mediaPath,
+		})
+		if err := l.db.MarkCommandCompleted(ctx, cmd.ID, result); err != nil {
+			log.Error().Err(err).Int64("command_id", cmd.ID).Msg("failed to mark command completed")
+		}
+	}()
+}
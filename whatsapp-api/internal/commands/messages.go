@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	waProto "go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/store"
+)
+
+// editMessagePayload is the expected JSON shape for edit_message commands.
+type editMessagePayload struct {
+	MessageID string `json:"message_id"`
+	Content   string `json:"content"`
+}
+
+// revokeMessagePayload is the expected JSON shape for revoke_message commands.
+type revokeMessagePayload struct {
+	MessageID string `json:"message_id"`
+}
+
+// ownMessage parses the chat JID and verifies that messageID is a message we
+// sent in that chat and that it has not been revoked.
+func (l *Listener) ownMessage(ctx context.Context, chatID, messageID string) (types.JID, *store.StoredMessage, error) {
+	if messageID == "" {
+		return types.JID{}, nil, fmt.Errorf("message_id is required")
+	}
+
+	chatJID, err := types.ParseJID(chatID)
+	if err != nil {
+		return types.JID{}, nil, fmt.Errorf("invalid chat_id JID: %v", err)
+	}
+
+	msg, err := l.db.GetMessage(ctx, chatID, messageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return types.JID{}, nil, fmt.Errorf("message %s not found in chat", messageID)
+		}
+		return types.JID{}, nil, fmt.Errorf("failed to look up message: %v", err)
+	}
+	if !msg.IsFromMe {
+		return types.JID{}, nil, fmt.Errorf("message %s was not sent by us", messageID)
+	}
+	if msg.IsRevoked {
+		return types.JID{}, nil, fmt.Errorf("message %s has already been revoked", messageID)
+	}
+	return chatJID, msg, nil
+}
+
+func (l *Listener) handleEditMessage(ctx context.Context, cmd *store.BridgeCommand) {
+	var payload editMessagePayload
+	if err := json.Unmarshal(cmd.Payload, &payload); err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("invalid payload: %v", err))
+		return
+	}
+	if payload.Content == "" {
+		l.db.MarkCommandFailed(ctx, cmd.ID, "content is required")
+		return
+	}
+
+	chatJID, msg, err := l.ownMessage(ctx, cmd.ChatID, payload.MessageID)
+	if err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, err.Error())
+		return
+	}
+	if msg.MessageType != "text" {
+		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("only text messages can be edited, got %s", msg.MessageType))
+		return
+	}
+
+	edit := l.client.BuildEdit(chatJID, types.MessageID(payload.MessageID), &waProto.Message{
+		Conversation: proto.String(payload.Content),
+	})
+
+	sendStart := time.Now()
+	resp, err := l.client.SendMessage(ctx, chatJID, edit)
+	metrics.WASendDuration.WithLabelValues("command").Observe(time.Since(sendStart).Seconds())
+	if err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("failed to send edit: %v", err))
+		return
+	}
+
+	if err := l.db.ApplyMessageEdit(ctx, payload.MessageID, cmd.ChatID, payload.Content, resp.Timestamp); err != nil {
+		log.Error().Err(err).Str("message_id", payload.MessageID).Msg("failed to apply own message edit")
+	}
+
+	result, _ := json.Marshal(map[string]string{
+		"message_id":      payload.MessageID,
+		"edit_message_id": resp.ID,
+	})
+	if err := l.db.MarkCommandCompleted(ctx, cmd.ID, result); err != nil {
+		log.Error().Err(err).Int64("command_id", cmd.ID).Msg("failed to mark command completed")
+	}
+
+	log.Info().Int64("command_id", cmd.ID).Str("chat_id", cmd.ChatID).Str("message_id", payload.MessageID).Msg("message edited")
+}
+
+func (l *Listener) handleRevokeMessage(ctx context.Context, cmd *store.BridgeCommand) {
+	var payload revokeMessagePayload
+	if err := json.Unmarshal(cmd.Payload, &payload); err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("invalid payload: %v", err))
+		return
+	}
+
+	chatJID, _, err := l.ownMessage(ctx, cmd.ChatID, payload.MessageID)
+	if err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, err.Error())
+		return
+	}
+
+	// An empty sender revokes our own message.
+	revoke := l.client.BuildRevoke(chatJID, types.EmptyJID, types.MessageID(payload.MessageID))
+
+	sendStart := time.Now()
+	resp, err := l.client.SendMessage(ctx, chatJID, revoke)
+	metrics.WASendDuration.WithLabelValues("command").Observe(time.Since(sendStart).Seconds())
+	if err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("failed to send revoke: %v", err))
+		return
+	}
+
+	if _, err := l.db.RevokeMessage(ctx, payload.MessageID, cmd.ChatID, resp.Timestamp); err != nil {
+		log.Error().Err(err).Str("message_id", payload.MessageID).Msg("failed to apply own message revoke")
+	}
+
+	result, _ := json.Marshal(map[string]string{
+		"message_id":        payload.MessageID,
+		"revoke_message_id": resp.ID,
+	})
+	if err := l.db.MarkCommandCompleted(ctx, cmd.ID, result); err != nil {
+		log.Error().Err(err).Int64("command_id", cmd.ID).Msg("failed to mark command completed")
+	}
+
+	log.Info().Int64("command_id", cmd.ID).Str("chat_id", cmd.ChatID).Str("message_id", payload.MessageID).Msg("message revoked")
+}
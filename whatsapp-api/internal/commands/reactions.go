@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mau.fi/whatsmeow/types"
+
+	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/outbox"
+	"whatsapp-bridge/internal/store"
+)
+
+// sendReactionPayload is the expected JSON shape for send_reaction commands.
+// An empty emoji removes our reaction.
+type sendReactionPayload struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+func (l *Listener) handleSendReaction(ctx context.Context, cmd *store.BridgeCommand) {
+	var payload sendReactionPayload
+	if err := json.Unmarshal(cmd.Payload, &payload); err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, fmt.Sprintf("invalid payload: %v", err))
+		return
+	}
+
+	reactionID, err := l.SendReaction(ctx, cmd.ChatID, payload.MessageID, payload.Emoji)
+	if err != nil {
+		l.db.MarkCommandFailed(ctx, cmd.ID, err.Error())
+		return
+	}
+
+	result, _ := json.Marshal(map[string]string{
+		"message_id":          payload.MessageID,
+		"reaction_message_id": reactionID,
+	})
+	if err := l.db.MarkCommandCompleted(ctx, cmd.ID, result); err != nil {
+		log.Error().Err(err).Int64("command_id", cmd.ID).Msg("failed to mark command completed")
+	}
+}
+
+var (
+	// ErrInvalidReaction wraps SendReaction errors caused by the request
+	// itself rather than by WhatsApp or the database.
+	ErrInvalidReaction = errors.New("invalid reaction")
+	// ErrMessageNotFound is returned by SendReaction when the target message
+	// is not stored in the chat.
+	ErrMessageNotFound = errors.New("message not found in chat")
+)
+
+// SendReaction reacts to a stored message with emoji, or removes our reaction
+// when emoji is empty, and mirrors the change in wa_bridge.reactions. It
+// returns the WhatsApp ID of the reaction message. Used by the send_reaction
+// command and the POST /react endpoint.
+func (l *Listener) SendReaction(ctx context.Context, chatID, messageID, emoji string) (string, error) {
+	if messageID == "" {
+		return "", fmt.Errorf("%w: message_id is required", ErrInvalidReaction)
+	}
+
+	chatJID, err := types.ParseJID(chatID)
+	if err != nil {
+		return "", fmt.Errorf("%w: invalid chat_id JID: %v", ErrInvalidReaction, err)
+	}
+
+	target, err := l.db.GetMessage(ctx, chatID, messageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+		}
+		return "", fmt.Errorf("failed to look up message: %v", err)
+	}
+
+	// The reaction key names the target's author.
+	sender, err := outbox.MessageAuthor(l.client, chatJID, target)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidReaction, err)
+	}
+
+	reaction := l.client.BuildReaction(chatJID, sender, types.MessageID(messageID), emoji)
+
+	sendStart := time.Now()
+	resp, err := l.client.SendMessage(ctx, chatJID, reaction)
+	metrics.WASendDuration.WithLabelValues("reaction").Observe(time.Since(sendStart).Seconds())
+	if err != nil {
+		return "", fmt.Errorf("failed to send reaction: %v", err)
+	}
+
+	var ownID string
+	if l.client.Store.ID != nil {
+		ownID = l.client.Store.ID.User
+	}
+
+	if emoji == "" {
+		if err := l.db.DeleteReaction(ctx, messageID, chatID, ownID); err != nil {
+			log.Error().Err(err).Str("target_message_id", messageID).Msg("failed to delete own reaction")
+		}
+	} else if err := l.db.UpsertReaction(ctx, messageID, chatID, ownID, "", emoji, resp.Timestamp); err != nil {
+		log.Error().Err(err).Str("target_message_id", messageID).Str("emoji", emoji).Msg("failed to upsert own reaction")
+	}
+
+	log.Info().Str("chat_id", chatID).Str("target_message_id", messageID).Str("emoji", emoji).Msg("reaction sent")
+	return resp.ID, nil
+}
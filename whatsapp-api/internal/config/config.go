@@ -1,7 +1,11 @@
 package config
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"os"
+	"strconv"
+	"strings"
 
 	"whatsapp-bridge/internal/logging"
 )
@@ -18,6 +22,45 @@ type Config struct {
 	SupabaseURL          string
 	SupabaseServiceKey   string
 	IgnoreGroupMessages  bool
+	OutboxMaxAttempts    int
+	CallAutoReject       bool
+	CallRejectMessage    string
+	// HistoryMediaConcurrency caps parallel downloads of history-synced media.
+	HistoryMediaConcurrency int
+	// MediaRetryMaxAttempts caps automatic attempts to fetch missing media.
+	MediaRetryMaxAttempts int
+	// MediaMax*MB cap the size of attachments the bridge downloads, per
+	// media type. Stickers use the image limit.
+	MediaMaxImageMB    int
+	MediaMaxVideoMB    int
+	MediaMaxAudioMB    int
+	MediaMaxDocumentMB int
+	// MediaRetention maps "type", "type:class", "*:class" and "*" (class is
+	// customer or group) to the days stored media is kept; see
+	// MediaRetentionDays. Empty keeps media forever.
+	MediaRetention map[string]int
+	// MediaRetentionAction is delete or archive; archive moves expired files
+	// to MediaArchiveBucket.
+	MediaRetentionAction string
+	MediaArchiveBucket   string
+	// MediaRetentionIgnoreDocuments lets retention run when public.documents
+	// is missing or unreadable, at the cost of expiring tagged documents.
+	MediaRetentionIgnoreDocuments bool
+
+	// MediaStorage selects the media storage backend: supabase, local, s3,
+	// or empty when media is not stored.
+	MediaStorage string
+	// MediaLocalDir, MediaPublicURL and MediaSigningKey configure the local
+	// backend: where files live, the base URL signed links point at, and the
+	// key signing them.
+	MediaLocalDir   string
+	MediaPublicURL  string
+	MediaSigningKey string
+	// S3Endpoint and friends configure the S3-compatible backend.
+	S3Endpoint        string
+	S3Region          string
+	S3AccessKeyID     string
+	S3SecretAccessKey string
 }
 
 // Load reads configuration from environment variables and returns a Config.
@@ -48,7 +91,7 @@ func Load() Config {
 		log.Warn().Msg("IMAGE_WEBHOOK_URL not set, image messages won't be forwarded")
 	}
 
-	return Config{
+	cfg := Config{
 		DatabaseURL:         databaseURL,
 		ListenAddr:          listenAddr,
 		WebhookURL:          webhookURL,
@@ -57,10 +100,181 @@ func Load() Config {
 		SupabaseURL:         os.Getenv("SUPABASE_URL"),
 		SupabaseServiceKey:  os.Getenv("SUPABASE_SERVICE_KEY"),
 		IgnoreGroupMessages: os.Getenv("IGNORE_GROUP_MESSAGES") == "true",
+		OutboxMaxAttempts:   envInt("OUTBOX_MAX_ATTEMPTS", 5),
+		CallAutoReject:      os.Getenv("CALL_AUTO_REJECT") == "true",
+		CallRejectMessage:   os.Getenv("CALL_REJECT_MESSAGE"),
+
+		HistoryMediaConcurrency: envInt("HISTORY_MEDIA_CONCURRENCY", 2),
+		MediaRetryMaxAttempts:   envInt("MEDIA_RETRY_MAX_ATTEMPTS", 5),
+		MediaMaxImageMB:         envLimit("MEDIA_MAX_IMAGE_MB", 16),
+		MediaMaxVideoMB:         envLimit("MEDIA_MAX_VIDEO_MB", 100),
+		MediaMaxAudioMB:         envLimit("MEDIA_MAX_AUDIO_MB", 16),
+		MediaMaxDocumentMB:      envLimit("MEDIA_MAX_DOCUMENT_MB", 100),
+	}
+	loadMediaStorage(&cfg)
+	loadMediaRetention(&cfg)
+	return cfg
+}
+
+// loadMediaStorage reads the media storage settings. MEDIA_STORAGE defaults
+// to supabase when Supabase credentials are set; it panics if the chosen
+// backend is missing required variables.
+func loadMediaStorage(cfg *Config) {
+	cfg.MediaStorage = strings.ToLower(os.Getenv("MEDIA_STORAGE"))
+	if cfg.MediaStorage == "" && cfg.SupabaseURL != "" && cfg.SupabaseServiceKey != "" {
+		cfg.MediaStorage = "supabase"
+	}
+
+	switch cfg.MediaStorage {
+	case "":
+		log.Warn().Msg("no media storage configured, media won't be stored")
+	case "none":
+		cfg.MediaStorage = ""
+	case "supabase":
+		if cfg.SupabaseURL == "" || cfg.SupabaseServiceKey == "" {
+			panic("MEDIA_STORAGE=supabase requires SUPABASE_URL and SUPABASE_SERVICE_KEY")
+		}
+	case "local":
+		cfg.MediaLocalDir = os.Getenv("MEDIA_LOCAL_DIR")
+		if cfg.MediaLocalDir == "" {
+			cfg.MediaLocalDir = "media"
+		}
+		cfg.MediaPublicURL = os.Getenv("MEDIA_PUBLIC_URL")
+		if cfg.MediaPublicURL == "" {
+			cfg.MediaPublicURL = "http://localhost" + cfg.ListenAddr
+			if !strings.HasPrefix(cfg.ListenAddr, ":") {
+				cfg.MediaPublicURL = "http://" + cfg.ListenAddr
+			}
+		}
+		cfg.MediaSigningKey = os.Getenv("MEDIA_SIGNING_KEY")
+		if cfg.MediaSigningKey == "" {
+			log.Warn().Msg("MEDIA_SIGNING_KEY not set, signed media URLs won't survive a restart")
+			key := make([]byte, 32)
+			rand.Read(key)
+			cfg.MediaSigningKey = hex.EncodeToString(key)
+		}
+	case "s3":
+		cfg.S3Endpoint = os.Getenv("S3_ENDPOINT")
+		cfg.S3Region = os.Getenv("S3_REGION")
+		if cfg.S3Region == "" {
+			cfg.S3Region = "us-east-1"
+		}
+		cfg.S3AccessKeyID = os.Getenv("S3_ACCESS_KEY_ID")
+		cfg.S3SecretAccessKey = os.Getenv("S3_SECRET_ACCESS_KEY")
+		if cfg.S3Endpoint == "" || cfg.S3AccessKeyID == "" || cfg.S3SecretAccessKey == "" {
+			panic("MEDIA_STORAGE=s3 requires S3_ENDPOINT, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+		}
+	default:
+		panic("MEDIA_STORAGE must be supabase, local, s3 or none")
+	}
+}
+
+// envInt reads a positive integer from the named environment variable,
+// returning def when it is unset or invalid.
+func envInt(name string, def int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n <= 0 {
+		log.Warn().Str("name", name).Str("value", raw).Int("default", def).Msg("invalid integer env var, using default")
+		return def
+	}
+	return n
+}
+
+// envLimit reads a size limit from the named environment variable, where 0
+// means no limit, returning def when it is unset or invalid.
+func envLimit(name string, def int) int {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		log.Warn().Str("name", name).Str("value", raw).Int("default", def).Msg("invalid size limit env var, using default")
+		return def
+	}
+	return n
+}
+
+// loadMediaRetention parses MEDIA_RETENTION, a comma-separated list of
+// rule=days such as "sticker=30,video:group=90,*:customer=730". It panics on
+// malformed rules.
+func loadMediaRetention(cfg *Config) {
+	cfg.MediaRetention = make(map[string]int)
+	for _, rule := range strings.Split(os.Getenv("MEDIA_RETENTION"), ",") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(rule, "=")
+		days, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(value), "d"))
+		if !ok || err != nil || days <= 0 {
+			panic("MEDIA_RETENTION: invalid rule " + rule)
+		}
+		mediaType, class, _ := strings.Cut(strings.ToLower(strings.TrimSpace(key)), ":")
+		switch mediaType {
+		case "*", "image", "video", "audio", "document", "sticker":
+		default:
+			panic("MEDIA_RETENTION: unknown media type in rule " + rule)
+		}
+		switch class {
+		case "", "customer", "group":
+		default:
+			panic("MEDIA_RETENTION: chat class must be customer or group in rule " + rule)
+		}
+		cfg.MediaRetention[strings.ToLower(strings.TrimSpace(key))] = days
+	}
+
+	cfg.MediaRetentionAction = strings.ToLower(os.Getenv("MEDIA_RETENTION_ACTION"))
+	switch cfg.MediaRetentionAction {
+	case "":
+		cfg.MediaRetentionAction = "delete"
+	case "delete", "archive":
+	default:
+		panic("MEDIA_RETENTION_ACTION must be delete or archive")
+	}
+	cfg.MediaArchiveBucket = os.Getenv("MEDIA_ARCHIVE_BUCKET")
+	if cfg.MediaArchiveBucket == "" {
+		cfg.MediaArchiveBucket = "wa-media-archive"
+	}
+	cfg.MediaRetentionIgnoreDocuments = os.Getenv("MEDIA_RETENTION_IGNORE_DOCUMENTS") == "true"
+}
+
+// MediaRetentionDays returns how many days stored media of mediaType is kept
+// in customer (isGroup false) or group chats, or 0 to keep it forever. The
+// most specific rule wins: type:class, then type, then *:class, then *.
+func (c Config) MediaRetentionDays(mediaType string, isGroup bool) int {
+	class := "customer"
+	if isGroup {
+		class = "group"
+	}
+	for _, key := range []string{mediaType + ":" + class, mediaType, "*:" + class, "*"} {
+		if days, ok := c.MediaRetention[key]; ok {
+			return days
+		}
+	}
+	return 0
+}
+
+// MediaMaxBytes returns the download size limit for a media type, or 0 when
+// it is unlimited.
+func (c Config) MediaMaxBytes(mediaType string) int64 {
+	mb := c.MediaMaxImageMB
+	switch mediaType {
+	case "video":
+		mb = c.MediaMaxVideoMB
+	case "audio":
+		mb = c.MediaMaxAudioMB
+	case "document":
+		mb = c.MediaMaxDocumentMB
 	}
+	return int64(mb) << 20
 }
 
-// StorageConfigured reports whether Supabase storage credentials are present.
+// StorageConfigured reports whether a media storage backend is selected.
 func (c Config) StorageConfigured() bool {
-	return c.SupabaseURL != "" && c.SupabaseServiceKey != ""
+	return c.MediaStorage != ""
 }
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEnvLimit(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int
+	}{
+		{"", 16},
+		{"0", 0},
+		{"64", 64},
+		{"-1", 16},
+		{"lots", 16},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_LIMIT_MB", tt.value)
+		if got := envLimit("TEST_LIMIT_MB", 16); got != tt.want {
+			t.Errorf("envLimit(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMediaMaxBytes(t *testing.T) {
+	cfg := Config{MediaMaxImageMB: 16, MediaMaxVideoMB: 100, MediaMaxAudioMB: 0, MediaMaxDocumentMB: 50}
+	tests := []struct {
+		mediaType string
+		want      int64
+	}{
+		{"image", 16 << 20},
+		{"sticker", 16 << 20},
+		{"video", 100 << 20},
+		{"audio", 0},
+		{"document", 50 << 20},
+	}
+	for _, tt := range tests {
+		if got := cfg.MediaMaxBytes(tt.mediaType); got != tt.want {
+			t.Errorf("MediaMaxBytes(%q) = %d, want %d", tt.mediaType, got, tt.want)
+		}
+	}
+}
+
+func TestLoadMediaRetention(t *testing.T) {
+	tests := []struct {
+		value string
+		want  map[string]int
+	}{
+		{"", map[string]int{}},
+		{"sticker=30", map[string]int{"sticker": 30}},
+		{" Video:Group = 90d , *=730,", map[string]int{"video:group": 90, "*": 730}},
+		{"*:customer=365,image=60", map[string]int{"*:customer": 365, "image": 60}},
+	}
+	for _, tt := range tests {
+		t.Setenv("MEDIA_RETENTION", tt.value)
+		var cfg Config
+		loadMediaRetention(&cfg)
+		if !reflect.DeepEqual(cfg.MediaRetention, tt.want) {
+			t.Errorf("MEDIA_RETENTION=%q: got %v, want %v", tt.value, cfg.MediaRetention, tt.want)
+		}
+	}
+}
+
+func TestLoadMediaRetentionInvalid(t *testing.T) {
+	for _, value := range []string{
+		"sticker",
+		"sticker=",
+		"sticker=0",
+		"sticker=-5",
+		"sticker=soon",
+		"gif=30",
+		"video:family=30",
+	} {
+		t.Setenv("MEDIA_RETENTION", value)
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("MEDIA_RETENTION=%q: expected panic", value)
+				}
+			}()
+			var cfg Config
+			loadMediaRetention(&cfg)
+		}()
+	}
+}
+
+func TestLoadMediaRetentionAction(t *testing.T) {
+	tests := []struct {
+		action, bucket         string
+		wantAction, wantBucket string
+	}{
+		{"", "", "delete", "wa-media-archive"},
+		{"ARCHIVE", "old-media", "archive", "old-media"},
+	}
+	for _, tt := range tests {
+		t.Setenv("MEDIA_RETENTION", "")
+		t.Setenv("MEDIA_RETENTION_ACTION", tt.action)
+		t.Setenv("MEDIA_ARCHIVE_BUCKET", tt.bucket)
+		var cfg Config
+		loadMediaRetention(&cfg)
+		if cfg.MediaRetentionAction != tt.wantAction || cfg.MediaArchiveBucket != tt.wantBucket {
+			t.Errorf("action %q, bucket %q: got %q, %q, want %q, %q", tt.action, tt.bucket,
+				cfg.MediaRetentionAction, cfg.MediaArchiveBucket, tt.wantAction, tt.wantBucket)
+		}
+	}
+
+	t.Setenv("MEDIA_RETENTION_ACTION", "shred")
+	defer func() {
+		if recover() == nil {
+			t.Error("MEDIA_RETENTION_ACTION=shred: expected panic")
+		}
+	}()
+	var cfg Config
+	loadMediaRetention(&cfg)
+}
+
+func TestMediaRetentionDays(t *testing.T) {
+	cfg := Config{MediaRetention: map[string]int{
+		"video:group": 30,
+		"video":       90,
+		"*:group":     180,
+		"*":           730,
+		"sticker":     7,
+	}}
+	tests := []struct {
+		mediaType string
+		isGroup   bool
+		want      int
+	}{
+		{"video", true, 30},
+		{"video", false, 90},
+		{"image", true, 180},
+		{"image", false, 730},
+		{"sticker", true, 7},
+		{"sticker", false, 7},
+	}
+	for _, tt := range tests {
+		if got := cfg.MediaRetentionDays(tt.mediaType, tt.isGroup); got != tt.want {
+			t.Errorf("MediaRetentionDays(%q, %v) = %d, want %d", tt.mediaType, tt.isGroup, got, tt.want)
+		}
+	}
+
+	if got := (Config{}).MediaRetentionDays("image", false); got != 0 {
+		t.Errorf("MediaRetentionDays with no rules = %d, want 0", got)
+	}
+}
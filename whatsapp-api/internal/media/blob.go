@@ -0,0 +1,96 @@
+package media
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/store"
+)
+
+// BlobPath returns the content-addressed storage path of a file:
+// blobs/{first two hex digits}/{sha256}.{ext}. The extension comes from the
+// original file name when it has one, otherwise from the MIME type.
+func BlobPath(sha256Hex, fileName, mimeType string) string {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(fileName), "."))
+	if !isSafeExt(ext) {
+		ext = MimeToExt(mimeType)
+	}
+	return fmt.Sprintf("blobs/%s/%s.%s", sha256Hex[:2], sha256Hex, ext)
+}
+
+// isSafeExt reports whether a sender-supplied extension can go into an object
+// key as is.
+func isSafeExt(ext string) bool {
+	if ext == "" || len(ext) > 10 {
+		return false
+	}
+	for _, r := range ext {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// FindBlob returns the stored blob with the given SHA-256, or sql.ErrNoRows.
+func FindBlob(ctx context.Context, db *store.Store, fileSHA256 []byte) (store.MediaBlob, error) {
+	if len(fileSHA256) == 0 {
+		return store.MediaBlob{}, sql.ErrNoRows
+	}
+	return db.GetMediaBlob(ctx, hex.EncodeToString(fileSHA256))
+}
+
+// StoreBlob streams size bytes from src into the default bucket under their
+// content hash and records the blob, skipping the upload when a file with the
+// same content is already stored. fileSHA256 is the hash WhatsApp sent with
+// the attachment (whatsmeow verifies it on download); it is computed from src
+// when empty.
+func StoreBlob(ctx context.Context, storage Storage, db *store.Store, src io.ReadSeeker, size int64, fileSHA256 []byte, fileName, mimeType string) (store.MediaBlob, error) {
+	if len(fileSHA256) == 0 {
+		h := sha256.New()
+		if _, err := io.Copy(h, src); err != nil {
+			return store.MediaBlob{}, fmt.Errorf("hashing file: %w", err)
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			return store.MediaBlob{}, fmt.Errorf("rewinding file: %w", err)
+		}
+		fileSHA256 = h.Sum(nil)
+	}
+
+	blob, err := FindBlob(ctx, db, fileSHA256)
+	if err == nil {
+		metrics.MediaDedupTotal.WithLabelValues("reused").Inc()
+		return blob, nil
+	} else if err != sql.ErrNoRows {
+		return store.MediaBlob{}, fmt.Errorf("looking up blob: %w", err)
+	}
+
+	sum := hex.EncodeToString(fileSHA256)
+	blob = store.MediaBlob{
+		SHA256:   sum,
+		Bucket:   DefaultBucket,
+		Path:     BlobPath(sum, fileName, mimeType),
+		MimeType: mimeType,
+		Size:     size,
+	}
+
+	ulStart := time.Now()
+	err = storage.Upload(ctx, blob.Bucket, blob.Path, src, size, mimeType)
+	metrics.MediaUploadDuration.Observe(time.Since(ulStart).Seconds())
+	if err != nil {
+		return store.MediaBlob{}, err
+	}
+	if err := db.SaveMediaBlob(ctx, blob); err != nil {
+		return store.MediaBlob{}, fmt.Errorf("recording blob: %w", err)
+	}
+	metrics.MediaDedupTotal.WithLabelValues("uploaded").Inc()
+	return blob, nil
+}
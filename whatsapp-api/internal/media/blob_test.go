@@ -0,0 +1,38 @@
+package media
+
+import (
+	"mime"
+	"testing"
+)
+
+func TestBlobPath(t *testing.T) {
+	const sum = "ab12cd34ef"
+	tests := []struct {
+		fileName, mimeType, want string
+	}{
+		{"Quote.PDF", "application/pdf", "blobs/ab/ab12cd34ef.pdf"},
+		{"", "image/jpeg", "blobs/ab/ab12cd34ef.jpg"},
+		{"notes.tar.gz", "application/gzip", "blobs/ab/ab12cd34ef.gz"},
+		{"photo.jp g", "image/jpeg", "blobs/ab/ab12cd34ef.jpg"},
+		{"../../etc/passwd", "application/pdf", "blobs/ab/ab12cd34ef.pdf"},
+		{"archive.verylongextension", "application/pdf", "blobs/ab/ab12cd34ef.pdf"},
+	}
+	for _, tt := range tests {
+		if got := BlobPath(sum, tt.fileName, tt.mimeType); got != tt.want {
+			t.Errorf("BlobPath(%q, %q) = %q, want %q", tt.fileName, tt.mimeType, got, tt.want)
+		}
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	for _, name := range []string{"quote.pdf", "Orçamento março.pdf", `say "hi".txt`} {
+		disposition, params, err := mime.ParseMediaType(ContentDisposition(name))
+		if err != nil {
+			t.Errorf("ContentDisposition(%q) does not parse: %v", name, err)
+			continue
+		}
+		if disposition != "attachment" || params["filename"] != name {
+			t.Errorf("ContentDisposition(%q) = %s %v", name, disposition, params)
+		}
+	}
+}
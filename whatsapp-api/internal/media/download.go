@@ -0,0 +1,193 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waMmsRetry"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/store"
+)
+
+// mediaRetryTimeout bounds the wait for the phone to answer a media retry
+// receipt.
+const mediaRetryTimeout = 60 * time.Second
+
+// errMediaUnavailable means neither the CDN nor the sender's phone has the
+// file any more.
+var errMediaUnavailable = errors.New("media no longer available")
+
+// download fetches the attachment from the CDN into file, falling back to a
+// media retry receipt when the CDN copy has expired.
+func (p *Pipeline) download(ctx context.Context, t store.MediaTarget, file whatsmeow.File) error {
+	if t.Keys.DirectPath != "" {
+		err := p.downloadPath(ctx, t, t.Keys.DirectPath, file)
+		if !isExpiredMedia(err) {
+			return err
+		}
+		log.Debug().Err(err).Str("message_id", t.MessageID).Msg("media expired, requesting re-upload from phone")
+	}
+
+	directPath, err := p.requestReupload(ctx, t)
+	if err != nil {
+		return err
+	}
+	if err := p.db.UpdateMediaDirectPath(ctx, t.ChatID, t.MessageID, directPath); err != nil {
+		log.Error().Err(err).Str("message_id", t.MessageID).Msg("failed to store new media direct path")
+	}
+	return p.downloadPath(ctx, t, directPath, file)
+}
+
+// downloadPath downloads from directPath into file, replacing anything a
+// previous attempt left there.
+func (p *Pipeline) downloadPath(ctx context.Context, t store.MediaTarget, directPath string, file whatsmeow.File) error {
+	if err := file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind file: %w", err)
+	}
+
+	// whatsmeow moves on to the next CDN host after a failed download unless
+	// the context is cancelled, so cancel it when the size limit is hit
+	// rather than fetching an oversized file from every host.
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	err := p.client.DownloadMediaWithPathToFile(ctx, directPath, t.Keys.FileEncSHA256, t.Keys.FileSHA256,
+		t.Keys.MediaKey, -1, WhatsAppType(t.MediaType), "", cancelOnTooLarge{File: file, cancel: cancel})
+	if cause := context.Cause(ctx); errors.Is(cause, ErrTooLarge) {
+		return cause
+	}
+	return err
+}
+
+// cancelOnTooLarge cancels the download's context when a write to the
+// underlying LimitFile fails with ErrTooLarge.
+type cancelOnTooLarge struct {
+	whatsmeow.File
+	cancel context.CancelCauseFunc
+}
+
+func (c cancelOnTooLarge) Write(p []byte) (int, error) {
+	n, err := c.File.Write(p)
+	if errors.Is(err, ErrTooLarge) {
+		c.cancel(err)
+	}
+	return n, err
+}
+
+func (c cancelOnTooLarge) WriteAt(p []byte, off int64) (int, error) {
+	n, err := c.File.WriteAt(p, off)
+	if errors.Is(err, ErrTooLarge) {
+		c.cancel(err)
+	}
+	return n, err
+}
+
+// isExpiredMedia reports whether a download failed because the CDN no longer
+// has the file, which a media retry receipt can fix.
+func isExpiredMedia(err error) bool {
+	return errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith403) ||
+		errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) ||
+		errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith410) ||
+		errors.Is(err, whatsmeow.ErrNoURLPresent)
+}
+
+// requestReupload sends a media retry receipt asking the sender's phone to
+// re-upload the attachment, waits for the resulting events.MediaRetry and
+// returns the new direct path.
+func (p *Pipeline) requestReupload(ctx context.Context, t store.MediaTarget) (string, error) {
+	chatJID, err := types.ParseJID(t.ChatID)
+	if err != nil {
+		return "", fmt.Errorf("invalid chat_id JID: %v", err)
+	}
+	msgInfo := &types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     chatJID,
+			IsFromMe: t.IsFromMe,
+			IsGroup:  t.IsGroup,
+		},
+		ID: types.MessageID(t.MessageID),
+	}
+	// Group receipts name the member who sent the message, by the JID
+	// (phone number or LID) it was sent from.
+	if t.IsGroup {
+		switch {
+		case t.SenderJID != "":
+			if msgInfo.Sender, err = types.ParseJID(t.SenderJID); err != nil {
+				return "", fmt.Errorf("invalid sender_jid: %v", err)
+			}
+		case t.IsFromMe && p.client.Store.ID != nil:
+			msgInfo.Sender = p.client.Store.ID.ToNonAD()
+		default:
+			return "", fmt.Errorf("sender of group message %s is unknown", t.MessageID)
+		}
+	}
+
+	ch := make(chan *events.MediaRetry, 1)
+	p.mu.Lock()
+	p.retries[msgInfo.ID] = ch
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		delete(p.retries, msgInfo.ID)
+		p.mu.Unlock()
+	}()
+
+	if err := p.client.SendMediaRetryReceipt(ctx, msgInfo, t.Keys.MediaKey); err != nil {
+		metrics.MediaRetryTotal.WithLabelValues("error").Inc()
+		return "", fmt.Errorf("failed to send media retry receipt: %w", err)
+	}
+
+	var evt *events.MediaRetry
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case <-time.After(mediaRetryTimeout):
+		metrics.MediaRetryTotal.WithLabelValues("timeout").Inc()
+		return "", fmt.Errorf("no media retry response from phone after %s", mediaRetryTimeout)
+	case evt = <-ch:
+	}
+
+	notif, err := whatsmeow.DecryptMediaRetryNotification(evt, t.Keys.MediaKey)
+	if errors.Is(err, whatsmeow.ErrMediaNotAvailableOnPhone) {
+		metrics.MediaRetryTotal.WithLabelValues("not_found").Inc()
+		return "", fmt.Errorf("%w: %v", errMediaUnavailable, err)
+	} else if err != nil {
+		metrics.MediaRetryTotal.WithLabelValues("error").Inc()
+		return "", fmt.Errorf("media retry failed: %w", err)
+	}
+	switch notif.GetResult() {
+	case waMmsRetry.MediaRetryNotification_SUCCESS:
+	case waMmsRetry.MediaRetryNotification_NOT_FOUND:
+		metrics.MediaRetryTotal.WithLabelValues("not_found").Inc()
+		return "", fmt.Errorf("%w: phone reported %s", errMediaUnavailable, notif.GetResult())
+	default:
+		metrics.MediaRetryTotal.WithLabelValues("error").Inc()
+		return "", fmt.Errorf("media retry failed: %s", notif.GetResult())
+	}
+	metrics.MediaRetryTotal.WithLabelValues("success").Inc()
+	return notif.GetDirectPath(), nil
+}
+
+// HandleMediaRetry is called from the event handler when the phone answers a
+// media retry receipt. It hands the response to the download waiting for it.
+func (p *Pipeline) HandleMediaRetry(evt *events.MediaRetry) {
+	p.mu.Lock()
+	ch, ok := p.retries[evt.MessageID]
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+	select {
+	case ch <- evt:
+	default:
+	}
+}
@@ -0,0 +1,70 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.mau.fi/whatsmeow"
+)
+
+// ErrTooLarge is returned for attachments above the configured size limit.
+var ErrTooLarge = errors.New("file exceeds size limit")
+
+// encryptionOverhead covers the AES-CBC padding and MAC that encrypted
+// downloads carry on top of the plaintext size.
+const encryptionOverhead = 32
+
+// CheckSize returns an error wrapping ErrTooLarge when size exceeds limit.
+// A limit of zero or less means no limit.
+func CheckSize(size, limit int64) error {
+	if limit > 0 && size > limit {
+		return fmt.Errorf("%w: %.1f MB > %.1f MB", ErrTooLarge, float64(size)/(1<<20), float64(limit)/(1<<20))
+	}
+	return nil
+}
+
+// LimitFile wraps f for whatsmeow's DownloadToFile so that writing more than
+// limit bytes (plus encryption overhead) fails with ErrTooLarge, aborting
+// downloads whose declared size was wrong. A limit of zero or less means no
+// limit.
+func LimitFile(f *os.File, limit int64) whatsmeow.File {
+	if limit <= 0 {
+		return f
+	}
+	return &limitFile{f: f, limit: limit + encryptionOverhead}
+}
+
+// limitFile deliberately does not embed *os.File so that io.Copy cannot
+// bypass Write through os.File's ReadFrom.
+type limitFile struct {
+	f     *os.File
+	limit int64
+}
+
+func (l *limitFile) Read(p []byte) (int, error)              { return l.f.Read(p) }
+func (l *limitFile) ReadAt(p []byte, off int64) (int, error) { return l.f.ReadAt(p, off) }
+func (l *limitFile) Seek(off int64, whence int) (int64, error) {
+	return l.f.Seek(off, whence)
+}
+func (l *limitFile) Truncate(size int64) error  { return l.f.Truncate(size) }
+func (l *limitFile) Stat() (os.FileInfo, error) { return l.f.Stat() }
+
+func (l *limitFile) Write(p []byte) (int, error) {
+	off, err := l.f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	if off+int64(len(p)) > l.limit {
+		return 0, fmt.Errorf("%w: more than %.1f MB", ErrTooLarge, float64(l.limit-encryptionOverhead)/(1<<20))
+	}
+	return l.f.Write(p)
+}
+
+func (l *limitFile) WriteAt(p []byte, off int64) (int, error) {
+	if off+int64(len(p)) > l.limit {
+		return 0, fmt.Errorf("%w: more than %.1f MB", ErrTooLarge, float64(l.limit-encryptionOverhead)/(1<<20))
+	}
+	return l.f.WriteAt(p, off)
+}
@@ -0,0 +1,65 @@
+package media
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckSize(t *testing.T) {
+	tests := []struct {
+		size, limit int64
+		tooLarge    bool
+	}{
+		{10, 0, false},
+		{10, -1, false},
+		{10, 10, false},
+		{11, 10, true},
+		{0, 10, false},
+	}
+	for _, tt := range tests {
+		err := CheckSize(tt.size, tt.limit)
+		if got := errors.Is(err, ErrTooLarge); got != tt.tooLarge {
+			t.Errorf("CheckSize(%d, %d) = %v, want too large %v", tt.size, tt.limit, err, tt.tooLarge)
+		}
+	}
+}
+
+func TestLimitFile(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "media"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if LimitFile(f, 0) != f {
+		t.Error("LimitFile without a limit should return the file itself")
+	}
+
+	const limit = 100
+	lf := LimitFile(f, limit)
+	// The limit allows for the encryption overhead on top of the plaintext.
+	if _, err := io.Copy(lf, strings.NewReader(strings.Repeat("x", limit+encryptionOverhead))); err != nil {
+		t.Fatalf("writing up to the limit: %v", err)
+	}
+	if _, err := lf.Write([]byte("x")); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("write past the limit: %v, want ErrTooLarge", err)
+	}
+	if _, err := lf.WriteAt([]byte("x"), limit+encryptionOverhead); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("WriteAt past the limit: %v, want ErrTooLarge", err)
+	}
+
+	// A retry starts over from a truncated file.
+	if err := lf.Truncate(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lf.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lf.Write([]byte("again")); err != nil {
+		t.Errorf("write after truncating: %v", err)
+	}
+}
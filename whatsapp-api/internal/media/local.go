@@ -0,0 +1,176 @@
+package media
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidSignature is returned by LocalStorage.Verify for missing,
+// tampered or expired signed URLs.
+var ErrInvalidSignature = errors.New("invalid or expired signature")
+
+// LocalStorage keeps media on the local filesystem under root/{bucket}/{key}.
+// Signed URLs point at the bridge's own GET /media route and carry an
+// HMAC-SHA256 signature over the object and expiry time.
+type LocalStorage struct {
+	root       string
+	publicURL  string
+	signingKey []byte
+}
+
+// NewLocalStorage returns a Storage rooted at dir, creating it if needed.
+// publicURL is the base URL the bridge is reachable at.
+func NewLocalStorage(dir, publicURL, signingKey string) (*LocalStorage, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("resolving media dir: %w", err)
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("creating media dir: %w", err)
+	}
+	return &LocalStorage{
+		root:       root,
+		publicURL:  strings.TrimRight(publicURL, "/"),
+		signingKey: []byte(signingKey),
+	}, nil
+}
+
+func (s *LocalStorage) Backend() string { return BackendLocal }
+
+// File returns the filesystem path of bucket/key, rejecting keys that would
+// escape the bucket directory.
+func (s *LocalStorage) File(bucket, key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if bucket == "" || strings.ContainsAny(bucket, `/\`) || bucket == "." || bucket == ".." || clean == "/" || clean != "/"+key {
+		return "", fmt.Errorf("invalid object path %s/%s", bucket, key)
+	}
+	return filepath.Join(s.root, bucket, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalStorage) Upload(ctx context.Context, bucket, key string, body io.Reader, size int64, mimeType string) error {
+	file, err := s.File(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+
+	// Write to a temporary file and rename so readers never see a partial
+	// object.
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("creating file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("renaming file: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) Download(ctx context.Context, bucket, key string) ([]byte, string, error) {
+	file, err := s.File(bucket, key)
+	if err != nil {
+		return nil, "", err
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading file: %w", err)
+	}
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return data, contentType, nil
+}
+
+func (s *LocalStorage) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	file, err := s.File(srcBucket, srcKey)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	defer src.Close()
+	return s.Upload(ctx, dstBucket, dstKey, src, -1, "")
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, bucket, key string) error {
+	file, err := s.File(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("deleting file: %w", err)
+	}
+	// Directories are left in place: blobs/xx/ is shared, and an Upload may
+	// be about to write into it.
+	return nil
+}
+
+// SignedURL passes fileName on in the name parameter, which the GET /media
+// route sends back as Content-Disposition.
+func (s *LocalStorage) SignedURL(ctx context.Context, bucket, key string, expiry time.Duration, fileName string) (string, error) {
+	if _, err := s.File(bucket, key); err != nil {
+		return "", err
+	}
+	expires := time.Now().Add(expiry).Unix()
+	q := url.Values{}
+	q.Set("expires", strconv.FormatInt(expires, 10))
+	q.Set("sig", s.sign(bucket, key, expires))
+	if fileName != "" {
+		q.Set("name", fileName)
+	}
+	return fmt.Sprintf("%s/media/%s/%s?%s", s.publicURL, bucket, escapePath(key), q.Encode()), nil
+}
+
+// Verify checks a signed URL's expires and sig parameters for bucket/key and
+// returns the file to serve.
+func (s *LocalStorage) Verify(bucket, key, expires, sig string) (string, error) {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return "", ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.sign(bucket, key, exp))) {
+		return "", ErrInvalidSignature
+	}
+	return s.File(bucket, key)
+}
+
+func (s *LocalStorage) sign(bucket, key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	fmt.Fprintf(mac, "%s/%s\n%d", bucket, key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// escapePath percent-encodes each segment of a slash-separated object key.
+func escapePath(key string) string {
+	parts := strings.Split(key, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return strings.Join(parts, "/")
+}
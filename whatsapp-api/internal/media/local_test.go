@@ -0,0 +1,114 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalStorageSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewLocalStorage(dir, "http://bridge:8080/", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := s.SignedURL(context.Background(), "wa-media", "blobs/ab/ab12 x.pdf", time.Minute, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "/media/wa-media/blobs/ab/ab12 x.pdf"; u.Path != want {
+		t.Errorf("signed URL path = %q, want %q", u.Path, want)
+	}
+	q := u.Query()
+
+	file, err := s.Verify("wa-media", "blobs/ab/ab12 x.pdf", q.Get("expires"), q.Get("sig"))
+	if err != nil {
+		t.Fatalf("Verify of a fresh URL: %v", err)
+	}
+	if want := filepath.Join(dir, "wa-media", "blobs", "ab", "ab12 x.pdf"); file != want {
+		t.Errorf("Verify returned %q, want %q", file, want)
+	}
+
+	expired := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	later := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	other, _ := NewLocalStorage(dir, "http://bridge:8080", "other")
+	otherSig := other.sign("wa-media", "blobs/ab/ab12 x.pdf", mustParse(t, q.Get("expires")))
+
+	tests := []struct {
+		name, bucket, key, expires, sig string
+	}{
+		{"other key", "wa-media", "blobs/ab/other.pdf", q.Get("expires"), q.Get("sig")},
+		{"other bucket", "archive", "blobs/ab/ab12 x.pdf", q.Get("expires"), q.Get("sig")},
+		{"extended expiry", "wa-media", "blobs/ab/ab12 x.pdf", later, q.Get("sig")},
+		{"expired", "wa-media", "blobs/ab/ab12 x.pdf", expired, s.sign("wa-media", "blobs/ab/ab12 x.pdf", mustParse(t, expired))},
+		{"bad expiry", "wa-media", "blobs/ab/ab12 x.pdf", "soon", q.Get("sig")},
+		{"missing sig", "wa-media", "blobs/ab/ab12 x.pdf", q.Get("expires"), ""},
+		{"other signing key", "wa-media", "blobs/ab/ab12 x.pdf", q.Get("expires"), otherSig},
+	}
+	for _, tt := range tests {
+		if _, err := s.Verify(tt.bucket, tt.key, tt.expires, tt.sig); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: Verify error = %v, want ErrInvalidSignature", tt.name, err)
+		}
+	}
+}
+
+func TestLocalStorageSignedURLFileName(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir(), "http://bridge:8080", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := s.SignedURL(context.Background(), "wa-media", "blobs/ab/ab12.pdf", time.Minute, "Orçamento março.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(signed)
+	if got := u.Query().Get("name"); got != "Orçamento março.pdf" {
+		t.Errorf("name parameter = %q", got)
+	}
+}
+
+func TestLocalStorageFile(t *testing.T) {
+	s, err := NewLocalStorage(t.TempDir(), "http://bridge:8080", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct{ bucket, key string }{
+		{"wa-media", "../escape"},
+		{"wa-media", "blobs/../../escape"},
+		{"wa-media", "/abs"},
+		{"wa-media", ""},
+		{"..", "file"},
+		{"a/b", "file"},
+		{"", "file"},
+	} {
+		if _, err := s.File(tt.bucket, tt.key); err == nil {
+			t.Errorf("File(%q, %q) succeeded, want error", tt.bucket, tt.key)
+		}
+	}
+	if _, err := s.File("wa-media", "blobs/ab/file.jpg"); err != nil {
+		t.Errorf("File of a valid key: %v", err)
+	}
+	if _, err := s.SignedURL(context.Background(), "wa-media", "../escape", time.Minute, ""); err == nil ||
+		!strings.Contains(err.Error(), "invalid object path") {
+		t.Errorf("SignedURL of an escaping key: %v", err)
+	}
+}
+
+func mustParse(t *testing.T, s string) int64 {
+	t.Helper()
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
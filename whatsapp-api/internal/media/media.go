@@ -1,45 +1,134 @@
-// Package media handles downloading WhatsApp media attachments and uploading
-// them to Supabase Storage.
+// Package media handles downloading WhatsApp media attachments and moving
+// them to and from media storage (Supabase Storage, a local directory or an
+// S3-compatible object store).
 package media
 
 import (
-	"bytes"
-	"fmt"
-	"io"
-	"net/http"
+	"encoding/hex"
 	"strings"
 
 	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-bridge/internal/store"
 )
 
-// Info bundles the downloadable handle and MIME type for a media message.
+// DefaultBucket is the storage bucket holding chat media.
+const DefaultBucket = "wa-media"
+
+// Info bundles the downloadable handle, MIME type and file metadata for a
+// media message. Fields the message type does not carry are zero.
 type Info struct {
 	Downloadable whatsmeow.DownloadableMessage
 	MimeType     string
+	FileLength   uint64
+	FileSHA256   []byte
+	Width        uint32
+	Height       uint32
+	Seconds      uint32 // audio and video duration
+	PageCount    uint32 // documents
+	FileName     string // documents
+	Thumbnail    []byte // embedded JPEG preview (images, videos, documents)
 }
 
 // FromMessage extracts media information from a WhatsApp message event.
 // Returns nil when the message contains no media attachment.
 func FromMessage(msg *events.Message) *Info {
-	if img := msg.Message.GetImageMessage(); img != nil {
-		return &Info{Downloadable: img, MimeType: img.GetMimetype()}
+	return FromProto(msg.Message)
+}
+
+// FromProto extracts media information from an (unwrapped) message proto,
+// e.g. one taken from a history sync. Returns nil when the message contains
+// no media attachment.
+func FromProto(msg *waE2E.Message) *Info {
+	if img := msg.GetImageMessage(); img != nil {
+		return &Info{
+			Downloadable: img, MimeType: img.GetMimetype(),
+			FileLength: img.GetFileLength(), FileSHA256: img.GetFileSHA256(),
+			Width: img.GetWidth(), Height: img.GetHeight(),
+			Thumbnail: img.GetJPEGThumbnail(),
+		}
 	}
-	if vid := msg.Message.GetVideoMessage(); vid != nil {
-		return &Info{Downloadable: vid, MimeType: vid.GetMimetype()}
+	if vid := msg.GetVideoMessage(); vid != nil {
+		return &Info{
+			Downloadable: vid, MimeType: vid.GetMimetype(),
+			FileLength: vid.GetFileLength(), FileSHA256: vid.GetFileSHA256(),
+			Width: vid.GetWidth(), Height: vid.GetHeight(), Seconds: vid.GetSeconds(),
+			Thumbnail: vid.GetJPEGThumbnail(),
+		}
 	}
-	if aud := msg.Message.GetAudioMessage(); aud != nil {
-		return &Info{Downloadable: aud, MimeType: aud.GetMimetype()}
+	if aud := msg.GetAudioMessage(); aud != nil {
+		return &Info{
+			Downloadable: aud, MimeType: aud.GetMimetype(),
+			FileLength: aud.GetFileLength(), FileSHA256: aud.GetFileSHA256(),
+			Seconds: aud.GetSeconds(),
+		}
 	}
-	if doc := msg.Message.GetDocumentMessage(); doc != nil {
-		return &Info{Downloadable: doc, MimeType: doc.GetMimetype()}
+	if doc := msg.GetDocumentMessage(); doc != nil {
+		return &Info{
+			Downloadable: doc, MimeType: doc.GetMimetype(),
+			FileLength: doc.GetFileLength(), FileSHA256: doc.GetFileSHA256(),
+			PageCount: doc.GetPageCount(), FileName: doc.GetFileName(),
+			Thumbnail: doc.GetJPEGThumbnail(),
+		}
 	}
-	if stk := msg.Message.GetStickerMessage(); stk != nil {
-		return &Info{Downloadable: stk, MimeType: stk.GetMimetype()}
+	if stk := msg.GetStickerMessage(); stk != nil {
+		return &Info{
+			Downloadable: stk, MimeType: stk.GetMimetype(),
+			FileLength: stk.GetFileLength(), FileSHA256: stk.GetFileSHA256(),
+			Width: stk.GetWidth(), Height: stk.GetHeight(),
+		}
 	}
 	return nil
 }
 
+// Meta returns the file metadata stored on the message row.
+func (i *Info) Meta() store.MediaMeta {
+	meta := store.MediaMeta{
+		MimeType:        i.MimeType,
+		FileName:        i.FileName,
+		Size:            int64(i.FileLength),
+		Width:           int(i.Width),
+		Height:          int(i.Height),
+		DurationSeconds: int(i.Seconds),
+		PageCount:       int(i.PageCount),
+	}
+	if len(i.FileSHA256) > 0 {
+		meta.SHA256 = hex.EncodeToString(i.FileSHA256)
+	}
+	return meta
+}
+
+// Keys returns the key material needed to download the attachment again
+// later without the original message.
+func (i *Info) Keys() store.MediaKeys {
+	return store.MediaKeys{
+		DirectPath:    i.Downloadable.GetDirectPath(),
+		MediaKey:      i.Downloadable.GetMediaKey(),
+		FileSHA256:    i.Downloadable.GetFileSHA256(),
+		FileEncSHA256: i.Downloadable.GetFileEncSHA256(),
+		FileLength:    int64(i.FileLength),
+		MimeType:      i.MimeType,
+		Thumbnail:     i.Thumbnail,
+	}
+}
+
+// WhatsAppType maps a stored media_type to the whatsmeow media type used to
+// derive its decryption keys.
+func WhatsAppType(mediaType string) whatsmeow.MediaType {
+	switch mediaType {
+	case "video":
+		return whatsmeow.MediaVideo
+	case "audio":
+		return whatsmeow.MediaAudio
+	case "document":
+		return whatsmeow.MediaDocument
+	default: // image, sticker
+		return whatsmeow.MediaImage
+	}
+}
+
 // MimeToExt converts a MIME type string to a file extension (without the dot).
 func MimeToExt(mimeType string) string {
 	base := strings.Split(mimeType, ";")[0]
@@ -72,28 +161,3 @@ func MimeToExt(mimeType string) string {
 		return "bin"
 	}
 }
-
-// UploadToSupabase uploads data to a Supabase Storage bucket at the given
-// object path. It uses the service-role key for authorization.
-func UploadToSupabase(data []byte, supabaseURL, serviceKey, bucket, path, mimeType string) error {
-	url := fmt.Sprintf("%s/storage/v1/object/%s/%s", supabaseURL, bucket, path)
-	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
-	if err != nil {
-		return fmt.Errorf("creating request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+serviceKey)
-	req.Header.Set("Content-Type", mimeType)
-	req.Header.Set("x-upsert", "true")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("uploading: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("storage returned %d: %s", resp.StatusCode, string(body))
-	}
-	return nil
-}
@@ -0,0 +1,177 @@
+package media
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-bridge/internal/config"
+	"whatsapp-bridge/internal/logging"
+	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/store"
+)
+
+var log = logging.Component("media")
+
+// Pipeline downloads attachments and stores them: live messages (messaging),
+// history syncs, the retry sweep and retry_media (commands) all go through
+// Fetch. When the CDN copy has expired it asks the sender's phone to
+// re-upload it via a media retry receipt.
+type Pipeline struct {
+	client  *whatsmeow.Client
+	db      *store.Store
+	cfg     config.Config
+	storage Storage
+
+	mu      sync.Mutex
+	retries map[types.MessageID]chan *events.MediaRetry
+}
+
+// NewPipeline creates a Pipeline. storage may be nil, in which case Fetch
+// only downloads attachments for its use callback.
+func NewPipeline(client *whatsmeow.Client, db *store.Store, cfg config.Config, storage Storage) *Pipeline {
+	return &Pipeline{
+		client:  client,
+		db:      db,
+		cfg:     cfg,
+		storage: storage,
+		retries: make(map[types.MessageID]chan *events.MediaRetry),
+	}
+}
+
+// Storage returns the storage backend, or nil when none is configured.
+func (p *Pipeline) Storage() Storage {
+	return p.storage
+}
+
+// Fetch streams the attachment of t to a temporary file, uploads it to
+// storage (unless the same file is already stored) together with a
+// thumbnail, and records the resulting media_path, which it returns. When use
+// is set it is called with the downloaded file, concurrently with the upload;
+// the file is removed once it returns. Attachments over the media type's size
+// limit are not downloaded and ErrTooLarge is returned. Failures are recorded
+// on the message row for the retry sweep.
+func (p *Pipeline) Fetch(ctx context.Context, t store.MediaTarget, use func(src io.ReaderAt, size int64)) (string, error) {
+	if p.storage == nil && use == nil {
+		return "", nil
+	}
+	start := time.Now()
+
+	// Another message may already have brought the same file; only a use
+	// callback needs it downloaded again.
+	if p.storage != nil && use == nil {
+		if blob, err := FindBlob(ctx, p.db, t.Keys.FileSHA256); err == nil {
+			metrics.MediaDedupTotal.WithLabelValues("reused").Inc()
+			return p.stored(ctx, t, blob, nil, 0)
+		} else if err != sql.ErrNoRows {
+			// A blob being released by retention is retried by the sweep.
+			p.markFailed(ctx, t, store.MediaUploadFailed, err)
+			return "", fmt.Errorf("failed to look up blob: %w", err)
+		}
+	}
+
+	limit := p.cfg.MediaMaxBytes(t.MediaType)
+	if err := CheckSize(t.Keys.FileLength, limit); err != nil {
+		return "", p.skipTooLarge(ctx, t, err)
+	}
+
+	file, err := os.CreateTemp("", "wa-media-*")
+	if err != nil {
+		p.markFailed(ctx, t, store.MediaDownloadFailed, err)
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	var readers sync.WaitGroup
+	defer func() {
+		readers.Wait()
+		file.Close()
+		os.Remove(file.Name())
+	}()
+
+	dlStart := time.Now()
+	err = p.download(ctx, t, LimitFile(file, limit))
+	metrics.MediaDownloadDuration.WithLabelValues(t.MediaType).Observe(time.Since(dlStart).Seconds())
+	if errors.Is(err, ErrTooLarge) {
+		return "", p.skipTooLarge(ctx, t, err)
+	} else if err != nil {
+		status := store.MediaDownloadFailed
+		if errors.Is(err, errMediaUnavailable) {
+			status = store.MediaUnavailable
+		}
+		p.markFailed(ctx, t, status, err)
+		return "", fmt.Errorf("download: %w", err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		p.markFailed(ctx, t, store.MediaDownloadFailed, err)
+		return "", fmt.Errorf("failed to stat downloaded file: %w", err)
+	}
+	size := stat.Size()
+
+	if use != nil {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			use(file, size)
+		}()
+	}
+	if p.storage == nil {
+		return "", nil
+	}
+
+	blob, err := StoreBlob(ctx, p.storage, p.db, io.NewSectionReader(file, 0, size), size, t.Keys.FileSHA256, t.FileName, t.Keys.MimeType)
+	if err != nil {
+		p.markFailed(ctx, t, store.MediaUploadFailed, err)
+		return "", fmt.Errorf("upload: %w", err)
+	}
+	path, err := p.stored(ctx, t, blob, file, size)
+	if err != nil {
+		return "", err
+	}
+	metrics.MediaPipelineDuration.WithLabelValues(t.MediaType).Observe(time.Since(start).Seconds())
+	return path, nil
+}
+
+// skipTooLarge records an attachment over the size limit on the message,
+// stores its embedded thumbnail if it has one and returns cause.
+func (p *Pipeline) skipTooLarge(ctx context.Context, t store.MediaTarget, cause error) error {
+	log.Warn().Err(cause).Str("message_id", t.MessageID).Str("media_type", t.MediaType).Msg("media too large, not downloading")
+	metrics.MediaTooLargeTotal.WithLabelValues(t.MediaType).Inc()
+	p.markFailed(ctx, t, store.MediaSkippedTooLarge, cause)
+	if p.storage != nil {
+		if _, err := StoreThumbnail(ctx, p.storage, p.db, t.ChatID, t.MessageID, t.Keys.FileSHA256, t.Keys.Thumbnail, nil, 0, t.Keys.MimeType); err != nil {
+			log.Error().Err(err).Str("message_id", t.MessageID).Msg("failed to store thumbnail")
+		}
+	}
+	return cause
+}
+
+// stored points the message at blob, stores its thumbnail and returns its
+// media_path. src is nil when the file was not downloaded.
+func (p *Pipeline) stored(ctx context.Context, t store.MediaTarget, blob store.MediaBlob, src io.ReaderAt, size int64) (string, error) {
+	if err := p.db.SetMessageBlob(ctx, t.ChatID, t.MessageID, blob); err != nil {
+		p.markFailed(ctx, t, store.MediaUploadFailed, err)
+		return "", fmt.Errorf("failed to update media_path: %w", err)
+	}
+	if _, err := StoreThumbnail(ctx, p.storage, p.db, t.ChatID, t.MessageID, t.Keys.FileSHA256, t.Keys.Thumbnail, src, size, t.Keys.MimeType); err != nil {
+		log.Error().Err(err).Str("message_id", t.MessageID).Msg("failed to store thumbnail")
+	}
+	log.Debug().Str("message_id", t.MessageID).Str("media_path", blob.Path).Msg("media stored")
+	return blob.Path, nil
+}
+
+// markFailed records a failed download or upload on the message so the retry
+// sweep and the retry_media command can pick it up.
+func (p *Pipeline) markFailed(ctx context.Context, t store.MediaTarget, status string, cause error) {
+	if err := p.db.MarkMediaFailed(ctx, t.ChatID, t.MessageID, status, cause.Error()); err != nil {
+		log.Error().Err(err).Str("message_id", t.MessageID).Msg("failed to record media failure")
+	}
+}
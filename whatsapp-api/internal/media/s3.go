@@ -0,0 +1,268 @@
+package media
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3Service         = "s3"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3MaxPresign      = 7 * 24 * time.Hour
+	amzDateFormat     = "20060102T150405Z"
+)
+
+// emptySHA256 is the hex SHA-256 of an empty request body.
+var emptySHA256 = hex.EncodeToString(sha256.New().Sum(nil))
+
+// S3Storage keeps media in an S3-compatible object store (AWS S3, MinIO,
+// Cloudflare R2, ...). Requests use path-style addressing
+// ({endpoint}/{bucket}/{key}) and AWS Signature Version 4.
+type S3Storage struct {
+	endpoint  *url.URL
+	region    string
+	accessKey string
+	secretKey string
+}
+
+// NewS3Storage returns a Storage for the S3-compatible service at endpoint.
+func NewS3Storage(endpoint, region, accessKey, secretKey string) (*S3Storage, error) {
+	u, err := url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+	}
+	return &S3Storage{endpoint: u, region: region, accessKey: accessKey, secretKey: secretKey}, nil
+}
+
+func (s *S3Storage) Backend() string { return BackendS3 }
+
+func (s *S3Storage) objectURL(bucket, key string) *url.URL {
+	u := *s.endpoint
+	u.Path = s.endpoint.Path + "/" + bucket + "/" + key
+	u.RawPath = s.endpoint.EscapedPath() + "/" + awsEscape(bucket, false) + "/" + awsEscape(key, true)
+	return &u
+}
+
+// do signs and sends a request for bucket/key, turning non-2xx statuses into
+// errors.
+func (s *S3Storage) do(ctx context.Context, method, bucket, key string, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL(bucket, key).String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	payloadHash := emptySHA256
+	if body != nil {
+		// Streamed bodies are not hashed up front.
+		payloadHash = s3UnsignedPayload
+		if size >= 0 {
+			req.ContentLength = size
+		}
+	}
+	s.sign(req, payloadHash, time.Now().UTC())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(resp.Body)
+		return resp, fmt.Errorf("storage returned %d: %s", resp.StatusCode, string(msg))
+	}
+	return resp, nil
+}
+
+func (s *S3Storage) Upload(ctx context.Context, bucket, key string, body io.Reader, size int64, mimeType string) error {
+	header := http.Header{}
+	header.Set("Content-Type", mimeType)
+	resp, err := s.do(ctx, "PUT", bucket, key, body, size, header)
+	if err != nil {
+		return fmt.Errorf("uploading: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) Download(ctx context.Context, bucket, key string) ([]byte, string, error) {
+	resp, err := s.do(ctx, "GET", bucket, key, nil, 0, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("downloading: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading body: %w", err)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+func (s *S3Storage) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	header := http.Header{}
+	header.Set("x-amz-copy-source", "/"+awsEscape(srcBucket, false)+"/"+awsEscape(srcKey, true))
+	resp, err := s.do(ctx, "PUT", dstBucket, dstKey, nil, 0, header)
+	if err != nil {
+		return fmt.Errorf("copying: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, bucket, key string) error {
+	resp, err := s.do(ctx, "DELETE", bucket, key, nil, 0, nil)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("deleting: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// SignedURL returns a presigned GET URL. S3 caps the lifetime at seven days.
+func (s *S3Storage) SignedURL(ctx context.Context, bucket, key string, expiry time.Duration, fileName string) (string, error) {
+	if expiry > s3MaxPresign {
+		expiry = s3MaxPresign
+	}
+	now := time.Now().UTC()
+	u := s.objectURL(bucket, key)
+
+	q := url.Values{}
+	q.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	q.Set("X-Amz-Credential", s.accessKey+"/"+s.scope(now))
+	q.Set("X-Amz-Date", now.Format(amzDateFormat))
+	q.Set("X-Amz-Expires", strconv.Itoa(int(expiry.Seconds())))
+	q.Set("X-Amz-SignedHeaders", "host")
+	if fileName != "" {
+		q.Set("response-content-disposition", ContentDisposition(fileName))
+	}
+	query := canonicalQuery(q)
+
+	canonical := strings.Join([]string{
+		"GET",
+		u.EscapedPath(),
+		query,
+		"host:" + u.Host + "\n",
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+	sig := s.signature(now, canonical)
+
+	u.RawQuery = query + "&X-Amz-Signature=" + sig
+	return u.String(), nil
+}
+
+// sign adds SigV4 authorization headers to req.
+func (s *S3Storage) sign(req *http.Request, payloadHash string, now time.Time) {
+	req.Header.Set("x-amz-date", now.Format(amzDateFormat))
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	names := []string{"host"}
+	for k := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "content-type" {
+			names = append(names, lk)
+		}
+	}
+	sort.Strings(names)
+
+	var headers strings.Builder
+	for _, name := range names {
+		value := req.URL.Host
+		if name != "host" {
+			value = strings.TrimSpace(req.Header.Get(name))
+		}
+		headers.WriteString(name + ":" + value + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		headers.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, s.scope(now), signed, s.signature(now, canonical)))
+}
+
+func (s *S3Storage) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + s.region + "/" + s3Service + "/aws4_request"
+}
+
+// signature derives the SigV4 signing key for now and signs the canonical
+// request.
+func (s *S3Storage) signature(now time.Time, canonical string) string {
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		now.Format(amzDateFormat),
+		s.scope(now),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, s3Service)
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes q sorted by key with AWS URI encoding.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, awsEscape(k, false)+"="+awsEscape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes s the way SigV4 expects: everything except
+// unreserved characters, and '/' too unless keepSlash is set.
+func awsEscape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,65 @@
+package media
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"time"
+
+	"whatsapp-bridge/internal/config"
+)
+
+// Storage backend names accepted by MEDIA_STORAGE.
+const (
+	BackendSupabase = "supabase"
+	BackendLocal    = "local"
+	BackendS3       = "s3"
+)
+
+// Storage keeps media objects in named buckets. Keys are slash-separated
+// object paths such as those returned by BlobPath.
+type Storage interface {
+	// Backend returns the backend name (supabase, local or s3).
+	Backend() string
+	// Upload stores size bytes read from body under bucket/key, replacing any
+	// existing object. A negative size means the length is unknown.
+	Upload(ctx context.Context, bucket, key string, body io.Reader, size int64, mimeType string) error
+	// Download returns the object bytes and their Content-Type.
+	Download(ctx context.Context, bucket, key string) ([]byte, string, error)
+	// Copy copies an object within the backend, possibly to another bucket,
+	// without passing it through the bridge where the backend allows.
+	Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, bucket, key string) error
+	// SignedURL returns a URL that grants read access to the object without
+	// credentials until expiry has passed. When fileName is set, browsers
+	// save the download under that name instead of the object key.
+	SignedURL(ctx context.Context, bucket, key string, expiry time.Duration, fileName string) (string, error)
+}
+
+// ContentDisposition returns an attachment Content-Disposition header value
+// for fileName, encoding names that are not plain ASCII.
+func ContentDisposition(fileName string) string {
+	if v := mime.FormatMediaType("attachment", map[string]string{"filename": fileName}); v != "" {
+		return v
+	}
+	return "attachment"
+}
+
+// NewStorage returns the storage backend selected by cfg.MediaStorage, or nil
+// when media storage is disabled.
+func NewStorage(cfg config.Config) (Storage, error) {
+	switch cfg.MediaStorage {
+	case "":
+		return nil, nil
+	case BackendSupabase:
+		return NewSupabaseStorage(cfg.SupabaseURL, cfg.SupabaseServiceKey), nil
+	case BackendLocal:
+		return NewLocalStorage(cfg.MediaLocalDir, cfg.MediaPublicURL, cfg.MediaSigningKey)
+	case BackendS3:
+		return NewS3Storage(cfg.S3Endpoint, cfg.S3Region, cfg.S3AccessKeyID, cfg.S3SecretAccessKey)
+	default:
+		return nil, fmt.Errorf("unknown media storage backend %q", cfg.MediaStorage)
+	}
+}
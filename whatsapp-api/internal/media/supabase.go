@@ -0,0 +1,161 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// SupabaseStorage keeps media in Supabase Storage, authorized with the
+// service-role key.
+type SupabaseStorage struct {
+	url        string
+	serviceKey string
+}
+
+// NewSupabaseStorage returns a Storage backed by the Supabase project at url.
+func NewSupabaseStorage(url, serviceKey string) *SupabaseStorage {
+	return &SupabaseStorage{url: strings.TrimRight(url, "/"), serviceKey: serviceKey}
+}
+
+func (s *SupabaseStorage) Backend() string { return BackendSupabase }
+
+func (s *SupabaseStorage) objectURL(bucket, key string) string {
+	return fmt.Sprintf("%s/storage/v1/object/%s/%s", s.url, bucket, key)
+}
+
+// do sends req with the service-role key and returns the response, turning
+// non-2xx statuses into errors.
+func (s *SupabaseStorage) do(req *http.Request) (*http.Response, error) {
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("storage returned %d: %s", resp.StatusCode, string(body))
+	}
+	return resp, nil
+}
+
+func (s *SupabaseStorage) Upload(ctx context.Context, bucket, key string, body io.Reader, size int64, mimeType string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", s.objectURL(bucket, key), body)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	if size >= 0 {
+		req.ContentLength = size
+	}
+	req.Header.Set("Content-Type", mimeType)
+	req.Header.Set("x-upsert", "true")
+
+	resp, err := s.do(req)
+	if err != nil {
+		return fmt.Errorf("uploading: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *SupabaseStorage) Download(ctx context.Context, bucket, key string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.objectURL(bucket, key), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("creating request: %w", err)
+	}
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("downloading: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading body: %w", err)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+func (s *SupabaseStorage) Copy(ctx context.Context, srcBucket, srcKey, dstBucket, dstKey string) error {
+	body, _ := json.Marshal(map[string]string{
+		"bucketId":          srcBucket,
+		"sourceKey":         srcKey,
+		"destinationBucket": dstBucket,
+		"destinationKey":    dstKey,
+	})
+	req, err := http.NewRequestWithContext(ctx, "POST", s.url+"/storage/v1/object/copy", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.do(req)
+	if err != nil {
+		return fmt.Errorf("copying: %w", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *SupabaseStorage) Delete(ctx context.Context, bucket, key string) error {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", s.objectURL(bucket, key), nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+s.serviceKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("deleting: %w", err)
+	}
+	defer resp.Body.Close()
+	// Supabase answers 400 with a not_found error for missing objects.
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("storage returned %d: %s", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (s *SupabaseStorage) SignedURL(ctx context.Context, bucket, key string, expiry time.Duration, fileName string) (string, error) {
+	body, _ := json.Marshal(map[string]int{"expiresIn": int(expiry.Seconds())})
+	endpoint := fmt.Sprintf("%s/storage/v1/object/sign/%s/%s", s.url, bucket, key)
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.do(req)
+	if err != nil {
+		return "", fmt.Errorf("signing: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var signed struct {
+		SignedURL string `json:"signedURL"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&signed); err != nil {
+		return "", fmt.Errorf("decoding response: %w", err)
+	}
+	if signed.SignedURL == "" {
+		return "", fmt.Errorf("storage returned no signed URL")
+	}
+	signedURL := s.url + "/storage/v1" + signed.SignedURL
+	if fileName != "" {
+		// Supabase answers with Content-Disposition: attachment for the
+		// name given in the download parameter.
+		signedURL += "&download=" + url.QueryEscape(fileName)
+	}
+	return signedURL, nil
+}
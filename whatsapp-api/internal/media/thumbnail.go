@@ -0,0 +1,189 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // register decoders for image.Decode
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/store"
+)
+
+const (
+	// thumbnailSize bounds the longer side of generated thumbnails.
+	thumbnailSize    = 320
+	thumbnailQuality = 75
+	// maxScalePixels skips decoding images too large to scale cheaply.
+	maxScalePixels   = 40_000_000
+	pdfRenderTimeout = 20 * time.Second
+)
+
+// ThumbnailPath returns the storage path of an attachment's thumbnail:
+// thumbnails/{first two hex digits}/{sha256}.jpg, shared like the file
+// itself, or thumbnails/{chat_id}/{message_id}.jpg when the hash is unknown.
+func ThumbnailPath(fileSHA256 []byte, chatID, messageID string) string {
+	if len(fileSHA256) == 0 {
+		return fmt.Sprintf("thumbnails/%s/%s.jpg", chatID, messageID)
+	}
+	sum := hex.EncodeToString(fileSHA256)
+	return fmt.Sprintf("thumbnails/%s/%s.jpg", sum[:2], sum)
+}
+
+// Thumbnail returns a JPEG preview of an attachment and where it came from:
+// the thumbnail WhatsApp embeds in image, video and document messages, else
+// a downscaled copy of a JPEG, PNG or GIF image, else a render of the first
+// page of a PDF (needs pdftoppm from poppler-utils). src holds the size-byte
+// file, or is nil when the file was not downloaded. Returns nil when no
+// preview can be made.
+func Thumbnail(ctx context.Context, embedded []byte, src io.ReaderAt, size int64, mimeType string) ([]byte, string) {
+	if len(embedded) > 0 {
+		return embedded, "embedded"
+	}
+	if src == nil || size == 0 {
+		return nil, ""
+	}
+	switch strings.Split(mimeType, ";")[0] {
+	case "image/jpeg", "image/png", "image/gif":
+		if thumb := scaleImage(io.NewSectionReader(src, 0, size)); thumb != nil {
+			return thumb, "image"
+		}
+	case "application/pdf":
+		if thumb := renderPDF(ctx, src, size); thumb != nil {
+			return thumb, "pdf"
+		}
+	}
+	return nil, ""
+}
+
+// StoreThumbnail makes a preview of a message's attachment (see Thumbnail),
+// uploads it to the default bucket and records it as the message's
+// thumbnail_path. Returns "" when no preview could be made.
+func StoreThumbnail(ctx context.Context, storage Storage, db *store.Store, chatID, messageID string, fileSHA256, embedded []byte, src io.ReaderAt, size int64, mimeType string) (string, error) {
+	thumb, source := Thumbnail(ctx, embedded, src, size, mimeType)
+	if thumb == nil {
+		return "", nil
+	}
+
+	thumbPath := ThumbnailPath(fileSHA256, chatID, messageID)
+	if err := storage.Upload(ctx, DefaultBucket, thumbPath, bytes.NewReader(thumb), int64(len(thumb)), "image/jpeg"); err != nil {
+		return "", fmt.Errorf("uploading thumbnail: %w", err)
+	}
+	if err := db.SetThumbnailPath(ctx, chatID, messageID, thumbPath); err != nil {
+		return "", fmt.Errorf("recording thumbnail_path: %w", err)
+	}
+	metrics.MediaThumbnailTotal.WithLabelValues(source).Inc()
+	return thumbPath, nil
+}
+
+// scaleImage decodes an image and re-encodes it as a JPEG no larger than
+// thumbnailSize on either side, averaging the source pixels behind each
+// thumbnail pixel. Returns nil if the image cannot be decoded.
+func scaleImage(r io.ReadSeeker) []byte {
+	cfg, _, err := image.DecodeConfig(r)
+	if err != nil || cfg.Width*cfg.Height > maxScalePixels {
+		return nil
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil
+	}
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return nil
+	}
+	tw, th := w, h
+	if w > thumbnailSize || h > thumbnailSize {
+		if w >= h {
+			tw, th = thumbnailSize, max(1, h*thumbnailSize/w)
+		} else {
+			tw, th = max(1, w*thumbnailSize/h), thumbnailSize
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(bl / n), uint16(a / n)})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: thumbnailQuality}); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// renderPDF renders the first page of a PDF to a JPEG with pdftoppm. Returns
+// nil when pdftoppm is not installed or the render fails.
+func renderPDF(ctx context.Context, src io.ReaderAt, size int64) []byte {
+	bin, err := exec.LookPath("pdftoppm")
+	if err != nil {
+		return nil
+	}
+	dir, err := os.MkdirTemp("", "wa-thumb-")
+	if err != nil {
+		return nil
+	}
+	defer os.RemoveAll(dir)
+
+	// Downloads are already on disk; anything else is written out first.
+	in := filepath.Join(dir, "in.pdf")
+	if f, ok := src.(*os.File); ok {
+		in = f.Name()
+	} else if err := writeFile(in, io.NewSectionReader(src, 0, size)); err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, pdfRenderTimeout)
+	defer cancel()
+
+	out := filepath.Join(dir, "page")
+	cmd := exec.CommandContext(ctx, bin, "-jpeg", "-f", "1", "-l", "1", "-singlefile",
+		"-scale-to", strconv.Itoa(thumbnailSize), in, out)
+	if err := cmd.Run(); err != nil {
+		return nil
+	}
+	thumb, err := os.ReadFile(out + ".jpg")
+	if err != nil {
+		return nil
+	}
+	return thumb
+}
+
+func writeFile(name string, r io.Reader) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
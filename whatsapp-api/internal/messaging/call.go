@@ -0,0 +1,233 @@
+package messaging
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-bridge/internal/config"
+	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/store"
+	"whatsapp-bridge/internal/webhook"
+)
+
+const (
+	// callOfferWait bounds how long an accept or terminate waits for its
+	// call's offer to be recorded.
+	callOfferWait = 30 * time.Second
+	// callStateTTL is how long a call's ordering state is kept; calls whose
+	// terminate never arrives, and terminates for calls whose offer was never
+	// seen, are forgotten after it.
+	callStateTTL = time.Hour
+)
+
+// callState tracks one call for callEvents.
+type callState struct {
+	seen time.Time
+	// offerDone is closed once the offer has been recorded; nil until the
+	// offer is dispatched.
+	offerDone chan struct{}
+	// early is a terminate dispatched before the offer.
+	early *events.CallTerminate
+}
+
+// callEvents orders the handling of each call's events. Offer, accept and
+// terminate are each handled in their own goroutine, so without it a
+// terminate can reach the database before its offer is saved, or turn an
+// auto-rejected call into a missed one before the rejection is recorded. A
+// terminate dispatched before its offer is held and applied by the offer.
+// All methods are called synchronously from the event handler.
+type callEvents struct {
+	mu    sync.Mutex
+	calls map[string]*callState
+}
+
+var calls = &callEvents{calls: make(map[string]*callState)}
+
+// offer registers a call's offer. It returns a func to call once the offer
+// is recorded, and the call's terminate if that was dispatched first.
+func (c *callEvents) offer(callID string) (done func(), early *events.CallTerminate) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prune()
+
+	st := c.calls[callID]
+	if st == nil {
+		st = &callState{seen: time.Now()}
+		c.calls[callID] = st
+	}
+	early, st.early = st.early, nil
+	if early != nil {
+		delete(c.calls, callID)
+	}
+	ch := make(chan struct{})
+	st.offerDone = ch
+	return func() { close(ch) }, early
+}
+
+// accepted returns a channel closed once the call's offer is recorded, or
+// nil if the offer was not seen.
+func (c *callEvents) accepted(callID string) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if st := c.calls[callID]; st != nil {
+		return st.offerDone
+	}
+	return nil
+}
+
+// terminated returns a channel closed once the call's offer is recorded. If
+// the offer was not seen it returns nil and holds evt for a later offer; the
+// caller should still try to finish the call, whose offer may have been
+// recorded before a restart.
+func (c *callEvents) terminated(evt *events.CallTerminate) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prune()
+
+	st := c.calls[evt.CallID]
+	if st == nil || st.offerDone == nil {
+		c.calls[evt.CallID] = &callState{seen: time.Now(), early: evt}
+		return nil
+	}
+	delete(c.calls, evt.CallID)
+	return st.offerDone
+}
+
+// forget drops a call's state once it has been finished.
+func (c *callEvents) forget(callID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if st := c.calls[callID]; st != nil && st.offerDone == nil {
+		delete(c.calls, callID)
+	}
+}
+
+// prune drops state older than callStateTTL. Callers hold c.mu.
+func (c *callEvents) prune() {
+	for id, st := range c.calls {
+		if time.Since(st.seen) > callStateTTL {
+			delete(c.calls, id)
+		}
+	}
+}
+
+// waitForOffer blocks until offerDone is closed or callOfferWait passes.
+func waitForOffer(callID string, offerDone <-chan struct{}) {
+	if offerDone == nil {
+		return
+	}
+	select {
+	case <-offerDone:
+	case <-time.After(callOfferWait):
+		log.Warn().Str("call_id", callID).Msg("call offer not recorded in time")
+	}
+}
+
+// handleCallOffer records an incoming 1:1 call as a timeline row in the
+// caller's chat and, when CALL_AUTO_REJECT is enabled, rejects it and queues
+// the configured text reply through the outbox. early is the call's terminate
+// if it was dispatched before the offer; it is applied once the offer is
+// saved, and a call that has already ended is not rejected.
+func handleCallOffer(client *whatsmeow.Client, cfg config.Config, db *store.Store, evt *events.CallOffer, early *events.CallTerminate) {
+	ctx := context.Background()
+
+	chatJID := resolveChatJID(client, evt.From.ToNonAD())
+
+	// Record the rejection before sending it: the terminate that follows
+	// must find the call rejected rather than still ringing.
+	reject := cfg.CallAutoReject && early == nil
+	call := &store.Call{
+		ID:      evt.CallID,
+		IsVideo: evt.Data != nil && evt.Data.GetChildByTag("video").Tag == "video",
+		Status:  "ringing",
+	}
+	if reject {
+		call.Status = "rejected"
+	}
+	metrics.CallEventTotal.WithLabelValues("offer").Inc()
+
+	// The call shows up in the chat like a message: this creates the chat if
+	// needed and bumps last_message_at.
+	db.SaveMessage(store.MessagePayload{
+		Timestamp:   evt.Timestamp,
+		MessageID:   call.ID,
+		ChatID:      chatJID.String(),
+		SenderID:    chatJID.User,
+		MessageType: "call",
+		Text:        call.Text(),
+		Call:        call,
+	})
+	if err := db.SaveCallOffer(ctx, chatJID.String(), chatJID.User, call, evt.Timestamp); err != nil {
+		log.Error().Err(err).Str("call_id", call.ID).Msg("failed to save call offer")
+		return
+	}
+	log.Info().Str("call_id", call.ID).Str("chat_id", chatJID.String()).Bool("is_video", call.IsVideo).Msg("incoming call")
+
+	if early != nil {
+		handleCallTerminate(cfg, db, early)
+		return
+	}
+	if !reject {
+		return
+	}
+	if err := client.RejectCall(ctx, evt.From, evt.CallID); err != nil {
+		log.Error().Err(err).Str("call_id", call.ID).Msg("failed to reject call")
+		if err := db.UnmarkCallRejected(ctx, call.ID); err != nil {
+			log.Error().Err(err).Str("call_id", call.ID).Msg("failed to reset rejected call")
+		}
+		return
+	}
+	metrics.CallEventTotal.WithLabelValues("reject").Inc()
+
+	if cfg.CallRejectMessage != "" {
+		if err := db.EnqueueOutgoingMessage(ctx, chatJID.String(), cfg.CallRejectMessage); err != nil {
+			log.Error().Err(err).Str("call_id", call.ID).Msg("failed to queue call reject message")
+		}
+	}
+}
+
+// handleCallAccept records that a call was picked up on one of our devices.
+func handleCallAccept(db *store.Store, evt *events.CallAccept) {
+	if err := db.MarkCallAnswered(context.Background(), evt.CallID, evt.Timestamp); err != nil {
+		log.Error().Err(err).Str("call_id", evt.CallID).Msg("failed to mark call answered")
+		return
+	}
+	metrics.CallEventTotal.WithLabelValues("accept").Inc()
+}
+
+// handleCallTerminate finalises a call (missed, answered with duration, or
+// rejected) and forwards the final state to the message webhook.
+func handleCallTerminate(cfg config.Config, db *store.Store, evt *events.CallTerminate) {
+	call, chatID, err := db.FinishCall(context.Background(), evt.CallID, evt.Reason, evt.Timestamp)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Debug().Str("call_id", evt.CallID).Msg("terminate for unknown or finished call")
+			return
+		}
+		log.Error().Err(err).Str("call_id", evt.CallID).Msg("failed to finish call")
+		return
+	}
+	calls.forget(evt.CallID)
+	metrics.CallEventTotal.WithLabelValues("terminate").Inc()
+	log.Info().Str("call_id", call.ID).Str("status", call.Status).Int("duration_seconds", call.DurationSeconds).Msg("call ended")
+
+	if cfg.WebhookURL == "" {
+		return
+	}
+	chatJID, _ := types.ParseJID(chatID)
+	webhook.SendText(cfg.WebhookURL, store.MessagePayload{
+		Timestamp:   evt.Timestamp,
+		MessageID:   call.ID,
+		ChatID:      chatID,
+		SenderID:    chatJID.User,
+		MessageType: "call",
+		Text:        call.Text(),
+		Call:        call,
+	})
+}
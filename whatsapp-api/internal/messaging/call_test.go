@@ -0,0 +1,81 @@
+package messaging
+
+import (
+	"testing"
+
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+)
+
+func newCallEvents() *callEvents {
+	return &callEvents{calls: make(map[string]*callState)}
+}
+
+func callMeta(callID string) types.BasicCallMeta {
+	return types.BasicCallMeta{CallID: callID}
+}
+
+func TestCallEventsOfferFirst(t *testing.T) {
+	c := newCallEvents()
+	done, early := c.offer("call1")
+	if early != nil {
+		t.Fatalf("offer returned early terminate %v", early)
+	}
+
+	accepted := c.accepted("call1")
+	terminated := c.terminated(&events.CallTerminate{BasicCallMeta: callMeta("call1")})
+	if accepted == nil || terminated == nil {
+		t.Fatal("accept and terminate after the offer should wait for it")
+	}
+	select {
+	case <-terminated:
+		t.Fatal("terminate released before the offer was recorded")
+	default:
+	}
+	done()
+	<-accepted
+	<-terminated
+	if len(c.calls) != 0 {
+		t.Errorf("state left after terminate: %v", c.calls)
+	}
+}
+
+func TestCallEventsTerminateFirst(t *testing.T) {
+	c := newCallEvents()
+	evt := &events.CallTerminate{BasicCallMeta: callMeta("call1")}
+	if ch := c.terminated(evt); ch != nil {
+		t.Fatal("terminate before the offer should not wait")
+	}
+
+	done, early := c.offer("call1")
+	defer done()
+	if early != evt {
+		t.Fatalf("offer returned early terminate %v, want %v", early, evt)
+	}
+	if len(c.calls) != 0 {
+		t.Errorf("state left after the offer took the terminate: %v", c.calls)
+	}
+}
+
+func TestCallEventsUnknownAccept(t *testing.T) {
+	c := newCallEvents()
+	if ch := c.accepted("call1"); ch != nil {
+		t.Fatal("accept for an unseen call should not wait")
+	}
+}
+
+func TestCallEventsForget(t *testing.T) {
+	c := newCallEvents()
+	c.terminated(&events.CallTerminate{BasicCallMeta: callMeta("call1")})
+	c.forget("call1")
+	if len(c.calls) != 0 {
+		t.Errorf("held terminate not forgotten: %v", c.calls)
+	}
+
+	done, _ := c.offer("call2")
+	defer done()
+	c.forget("call2")
+	if c.calls["call2"] == nil {
+		t.Error("forget dropped a call whose offer is still being recorded")
+	}
+}
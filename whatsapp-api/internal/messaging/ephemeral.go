@@ -0,0 +1,60 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/whatsmeow/proto/waE2E"
+
+	"whatsapp-bridge/internal/store"
+	"whatsapp-bridge/internal/wamsg"
+)
+
+// contextInfo returns the ContextInfo of the content in m, or nil for content
+// types that do not carry one.
+func contextInfo(m *waE2E.Message) *waE2E.ContextInfo {
+	switch {
+	case m.ExtendedTextMessage != nil:
+		return m.ExtendedTextMessage.GetContextInfo()
+	case m.ImageMessage != nil:
+		return m.ImageMessage.GetContextInfo()
+	case m.VideoMessage != nil:
+		return m.VideoMessage.GetContextInfo()
+	case m.AudioMessage != nil:
+		return m.AudioMessage.GetContextInfo()
+	case m.DocumentMessage != nil:
+		return m.DocumentMessage.GetContextInfo()
+	case m.StickerMessage != nil:
+		return m.StickerMessage.GetContextInfo()
+	case m.ContactMessage != nil:
+		return m.ContactMessage.GetContextInfo()
+	case m.ContactsArrayMessage != nil:
+		return m.ContactsArrayMessage.GetContextInfo()
+	case m.LocationMessage != nil:
+		return m.LocationMessage.GetContextInfo()
+	case m.LiveLocationMessage != nil:
+		return m.LiveLocationMessage.GetContextInfo()
+	case m.ButtonsResponseMessage != nil:
+		return m.ButtonsResponseMessage.GetContextInfo()
+	case m.ListResponseMessage != nil:
+		return m.ListResponseMessage.GetContextInfo()
+	case m.TemplateButtonReplyMessage != nil:
+		return m.TemplateButtonReplyMessage.GetContextInfo()
+	case m.InteractiveResponseMessage != nil:
+		return m.InteractiveResponseMessage.GetContextInfo()
+	case wamsg.PollCreation(m) != nil:
+		return wamsg.PollCreation(m).GetContextInfo()
+	default:
+		return nil
+	}
+}
+
+// recordEphemeralTimer stores a chat's disappearing-messages timer so the
+// outbox can send with the same expiration.
+func recordEphemeralTimer(db *store.Store, chatID string, isGroup bool, expiration uint32, ts time.Time) {
+	if err := db.SetChatEphemeralExpiration(context.Background(), chatID, isGroup, expiration, ts); err != nil {
+		log.Error().Err(err).Str("chat_id", chatID).Uint32("expiration", expiration).Msg("failed to record ephemeral timer")
+		return
+	}
+	log.Debug().Str("chat_id", chatID).Uint32("expiration", expiration).Msg("ephemeral timer recorded")
+}
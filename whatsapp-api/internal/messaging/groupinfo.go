@@ -0,0 +1,123 @@
+package messaging
+
+import (
+	"context"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/store"
+	"whatsapp-bridge/internal/waclient"
+)
+
+// syncGroup stores the name, topic and full member list of a group.
+func syncGroup(ctx context.Context, client *whatsmeow.Client, db *store.Store, info *types.GroupInfo) error {
+	chatID := info.JID.String()
+	if err := db.UpsertGroupChat(ctx, chatID, info.Name, info.Topic, true); err != nil {
+		return err
+	}
+
+	participants := make([]store.GroupParticipant, 0, len(info.Participants))
+	for _, p := range info.Participants {
+		participants = append(participants, store.GroupParticipant{
+			ID:           waclient.ParticipantID(ctx, client, p.JID, p.PhoneNumber),
+			IsAdmin:      p.IsAdmin || p.IsSuperAdmin,
+			IsSuperAdmin: p.IsSuperAdmin,
+		})
+	}
+	return db.SyncGroupParticipants(ctx, chatID, participants, time.Now())
+}
+
+// handleJoinedGroup records a group we were added to (or created) together
+// with its members.
+func handleJoinedGroup(client *whatsmeow.Client, db *store.Store, evt *events.JoinedGroup) {
+	if err := syncGroup(context.Background(), client, db, &evt.GroupInfo); err != nil {
+		log.Error().Err(err).Str("chat_id", evt.JID.String()).Msg("failed to sync joined group")
+		return
+	}
+	metrics.GroupEventTotal.WithLabelValues("joined").Inc()
+	log.Info().Str("chat_id", evt.JID.String()).Str("name", evt.Name).Int("participants", len(evt.Participants)).Msg("joined group")
+}
+
+// handleGroupInfo applies a group metadata or membership change: renames,
+// topic changes, the disappearing-messages timer, and participants joining,
+// leaving, being promoted or demoted.
+func handleGroupInfo(client *whatsmeow.Client, db *store.Store, evt *events.GroupInfo) {
+	ctx := context.Background()
+	chatID := evt.JID.String()
+
+	if evt.Name != nil || evt.Topic != nil {
+		var name, topic string
+		if evt.Name != nil {
+			name = evt.Name.Name
+		}
+		if evt.Topic != nil {
+			topic = evt.Topic.Topic
+			if evt.Topic.TopicDeleted {
+				topic = ""
+			}
+		}
+		if err := db.UpsertGroupChat(ctx, chatID, name, topic, evt.Topic != nil); err != nil {
+			log.Error().Err(err).Str("chat_id", chatID).Msg("failed to update group name/topic")
+		} else {
+			metrics.GroupEventTotal.WithLabelValues("metadata").Inc()
+		}
+	} else if err := db.UpsertGroupChat(ctx, chatID, "", "", false); err != nil {
+		// Membership rows reference the chat, so make sure it exists.
+		log.Error().Err(err).Str("chat_id", chatID).Msg("failed to ensure group chat")
+		return
+	}
+
+	if evt.Ephemeral != nil {
+		var timer uint32
+		if evt.Ephemeral.IsEphemeral {
+			timer = evt.Ephemeral.DisappearingTimer
+		}
+		recordEphemeralTimer(db, chatID, true, timer, evt.Timestamp)
+	}
+
+	changes := []struct {
+		change string
+		jids   []types.JID
+	}{
+		{"join", evt.Join},
+		{"leave", evt.Leave},
+		{"promote", evt.Promote},
+		{"demote", evt.Demote},
+	}
+	for _, c := range changes {
+		if len(c.jids) == 0 {
+			continue
+		}
+		ids := make([]string, 0, len(c.jids))
+		for _, jid := range c.jids {
+			ids = append(ids, waclient.ParticipantID(ctx, client, jid, types.EmptyJID))
+		}
+		if err := db.ApplyGroupParticipantChange(ctx, chatID, ids, c.change, evt.Timestamp); err != nil {
+			log.Error().Err(err).Str("chat_id", chatID).Str("change", c.change).Msg("failed to apply participant change")
+			continue
+		}
+		metrics.GroupEventTotal.WithLabelValues(c.change).Inc()
+		log.Debug().Str("chat_id", chatID).Str("change", c.change).Strs("participants", ids).Msg("group participants changed")
+	}
+}
+
+// syncJoinedGroups refreshes name, topic and members of every group we are
+// in. Run on every events.Connected (startup and reconnects to WhatsApp) so
+// changes made while the bridge was offline are picked up.
+func syncJoinedGroups(ctx context.Context, client *whatsmeow.Client, db *store.Store) {
+	groups, err := client.GetJoinedGroups(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to fetch joined groups")
+		return
+	}
+	for _, info := range groups {
+		if err := syncGroup(ctx, client, db, info); err != nil {
+			log.Error().Err(err).Str("chat_id", info.JID.String()).Msg("failed to sync group")
+		}
+	}
+	log.Info().Int("count", len(groups)).Msg("synced group participants")
+}
@@ -58,7 +58,8 @@ func ListenGroupChats(ctx context.Context, client *whatsmeow.Client, db *store.S
 	}
 }
 
-// resolveGroupName fetches the group name from WhatsApp and updates the chat record.
+// resolveGroupName fetches the group info from WhatsApp and updates the chat
+// record's name and topic along with its members.
 func resolveGroupName(ctx context.Context, client *whatsmeow.Client, db *store.Store, chatID string) {
 	start := time.Now()
 
@@ -78,8 +79,8 @@ func resolveGroupName(ctx context.Context, client *whatsmeow.Client, db *store.S
 		return
 	}
 
-	if err := db.UpdateChatName(ctx, chatID, info.Name); err != nil {
-		log.Error().Err(err).Str("chat_id", chatID).Msg("failed to update group chat name")
+	if err := syncGroup(ctx, client, db, info); err != nil {
+		log.Error().Err(err).Str("chat_id", chatID).Msg("failed to sync group info")
 		metrics.GroupResolveTotal.WithLabelValues("error").Inc()
 		metrics.GroupResolveDuration.Observe(time.Since(start).Seconds())
 		return
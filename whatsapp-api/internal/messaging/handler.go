@@ -5,7 +5,9 @@ package messaging
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 	"time"
 
@@ -22,6 +24,7 @@ import (
 	"whatsapp-bridge/internal/media"
 	"whatsapp-bridge/internal/metrics"
 	"whatsapp-bridge/internal/store"
+	"whatsapp-bridge/internal/wamsg"
 	"whatsapp-bridge/internal/webhook"
 )
 
@@ -30,21 +33,49 @@ var log = logging.Component("messaging")
 // RegisterHandler attaches the message event handler to client. All
 // configuration and dependencies are provided explicitly so there is no
 // reliance on package-level globals.
-func RegisterHandler(client *whatsmeow.Client, cfg config.Config, db *store.Store, agentHandler *agent.Handler, cmdListener *commands.Listener) {
+func RegisterHandler(client *whatsmeow.Client, cfg config.Config, db *store.Store, pipeline *media.Pipeline, agentHandler *agent.Handler, cmdListener *commands.Listener) {
 	client.AddEventHandler(func(evt interface{}) {
 		log.Debug().Str("type", fmt.Sprintf("%T", evt)).Msg("event received")
 		switch v := evt.(type) {
 		case *events.Message:
-			go handleMessage(client, cfg, db, agentHandler, v)
+			go handleMessage(client, cfg, db, pipeline, agentHandler, v)
+		case *events.Receipt:
+			go handleReceipt(client, db, v)
+		case *events.GroupInfo:
+			go handleGroupInfo(client, db, v)
+		case *events.JoinedGroup:
+			go handleJoinedGroup(client, db, v)
+		case *events.Connected:
+			go syncJoinedGroups(context.Background(), client, db)
+		case *events.CallOffer:
+			done, early := calls.offer(v.CallID)
+			go func() {
+				defer done()
+				handleCallOffer(client, cfg, db, v, early)
+			}()
+		case *events.CallAccept:
+			offerDone := calls.accepted(v.CallID)
+			go func() {
+				waitForOffer(v.CallID, offerDone)
+				handleCallAccept(db, v)
+			}()
+		case *events.CallTerminate:
+			offerDone := calls.terminated(v)
+			go func() {
+				waitForOffer(v.CallID, offerDone)
+				handleCallTerminate(cfg, db, v)
+			}()
 		case *events.HistorySync:
 			if cmdListener != nil {
 				go cmdListener.HandleHistorySyncEvent(v)
 			}
+		case *events.MediaRetry:
+			go pipeline.HandleMediaRetry(v)
 		}
 	})
 }
 
-func handleMessage(client *whatsmeow.Client, cfg config.Config, db *store.Store, agentHandler *agent.Handler, msg *events.Message) {
+func handleMessage(client *whatsmeow.Client, cfg config.Config, db *store.Store, pipeline *media.Pipeline, agentHandler *agent.Handler, msg *events.Message) {
 	start := time.Now()
 
 	// Handle reactions separately — they are not regular messages.
@@ -53,6 +84,12 @@ func handleMessage(client *whatsmeow.Client, cfg config.Config, db *store.Store,
 		return
 	}
 
+	// Poll votes update the poll's tally rather than adding a message.
+	if update := msg.Message.GetPollUpdateMessage(); update != nil {
+		go handlePollVote(client, db, msg, update)
+		return
+	}
+
 	// Skip sender key distribution messages that carry no user-visible content.
 	// These are internal Signal protocol key rotation events that sometimes
 	// piggyback on real messages. Only skip when no actual content is present.
@@ -77,8 +114,14 @@ func handleMessage(client *whatsmeow.Client, cfg config.Config, db *store.Store,
 	// Handle protocol messages (edits, revocations, etc.) before building
 	// the regular payload. These are not user-visible content rows.
 	if proto := msg.Message.GetProtocolMessage(); proto != nil {
-		if proto.GetType() == waE2E.ProtocolMessage_MESSAGE_EDIT {
+		switch proto.GetType() {
+		case waE2E.ProtocolMessage_MESSAGE_EDIT:
 			go handleMessageEdit(client, db, msg, proto)
+		case waE2E.ProtocolMessage_REVOKE:
+			go handleRevoke(client, cfg, db, msg, proto)
+		case waE2E.ProtocolMessage_EPHEMERAL_SETTING:
+			chatID := resolveChatJID(client, msg.Info.Chat).String()
+			go recordEphemeralTimer(db, chatID, msg.Info.IsGroup, proto.GetEphemeralExpiration(), msg.Info.Timestamp)
 		}
 		return
 	}
@@ -93,6 +136,13 @@ func handleMessage(client *whatsmeow.Client, cfg config.Config, db *store.Store,
 		payload.ChatName = msg.Info.PushName
 	}
 
+	// Ephemeral messages carry the chat's current disappearing-messages timer.
+	if payload.IsEphemeral {
+		if exp := contextInfo(msg.Message).GetExpiration(); exp > 0 {
+			go recordEphemeralTimer(db, payload.ChatID, payload.IsGroup, exp, payload.Timestamp)
+		}
+	}
+
 	isGroup := "false"
 	if payload.IsGroup {
 		isGroup = "true"
@@ -113,6 +163,9 @@ func handleMessage(client *whatsmeow.Client, cfg config.Config, db *store.Store,
 	} else if !payload.IsGroup && !payload.IsFromMe && payload.MessageType != "other" {
 		// Save synchronously so the message is available when the agent reads history.
 		db.SaveMessage(payload)
+		if payload.MessageType == "media" {
+			go handleMedia(cfg, pipeline, payload)
+		}
 		// Trigger agent if active for this chat.
 		if agentHandler != nil {
 			active, err := db.IsAgentActive(context.Background(), payload.ChatID)
@@ -123,11 +176,13 @@ func handleMessage(client *whatsmeow.Client, cfg config.Config, db *store.Store,
 			}
 		}
 	} else {
-		go db.SaveMessage(payload)
-	}
-
-	if payload.MessageType == "media" {
-		go handleMedia(client, cfg, db, msg, payload)
+		// The media pipeline updates the row, so it must exist first.
+		go func() {
+			db.SaveMessage(payload)
+			if payload.MessageType == "media" {
+				handleMedia(cfg, pipeline, payload)
+			}
+		}()
 	}
 
 	if cfg.WebhookURL != "" && !(payload.MessageType == "media" && payload.Text == "") {
@@ -178,6 +233,14 @@ func hasUserContent(msg *events.Message) bool {
 		m.StickerMessage != nil ||
 		m.ContactMessage != nil ||
 		m.ContactsArrayMessage != nil ||
+		m.LocationMessage != nil ||
+		m.LiveLocationMessage != nil ||
+		wamsg.PollCreation(m) != nil ||
+		m.PollUpdateMessage != nil ||
+		m.ButtonsResponseMessage != nil ||
+		m.ListResponseMessage != nil ||
+		m.TemplateButtonReplyMessage != nil ||
+		m.InteractiveResponseMessage != nil ||
 		m.ReactionMessage != nil ||
 		m.ProtocolMessage != nil
 }
@@ -191,9 +254,13 @@ func buildPayload(msg *events.Message) store.MessagePayload {
 		MessageID:  msg.Info.ID,
 		ChatID:     msg.Info.Chat.String(),
 		SenderID:   sender,
+		SenderJID:  msg.Info.Sender.ToNonAD().String(),
 		SenderName: msg.Info.PushName,
 		IsGroup:    msg.Info.IsGroup,
 		IsFromMe:   msg.Info.IsFromMe,
+		// whatsmeow has already unwrapped view-once and ephemeral containers.
+		IsViewOnce:  msg.IsViewOnce,
+		IsEphemeral: msg.IsEphemeral,
 	}
 
 	switch {
@@ -237,10 +304,71 @@ func buildPayload(msg *events.Message) store.MessagePayload {
 			names = append(names, c.GetDisplayName())
 		}
 		payload.Text = strings.Join(names, ", ")
+	case msg.Message.LocationMessage != nil:
+		loc := msg.Message.LocationMessage
+		payload.MessageType = "location"
+		payload.Location = &store.Location{
+			Latitude:  loc.GetDegreesLatitude(),
+			Longitude: loc.GetDegreesLongitude(),
+			Name:      loc.GetName(),
+			Address:   loc.GetAddress(),
+			IsLive:    loc.GetIsLive(),
+		}
+		payload.Text = payload.Location.Text()
+		payload.ReplyToMessageID = loc.GetContextInfo().GetStanzaID()
+	case msg.Message.LiveLocationMessage != nil:
+		loc := msg.Message.LiveLocationMessage
+		payload.MessageType = "location"
+		payload.Location = &store.Location{
+			Latitude:  loc.GetDegreesLatitude(),
+			Longitude: loc.GetDegreesLongitude(),
+			Name:      loc.GetCaption(),
+			IsLive:    true,
+		}
+		payload.Text = payload.Location.Text()
+		payload.ReplyToMessageID = loc.GetContextInfo().GetStanzaID()
+	case msg.Message.ButtonsResponseMessage != nil:
+		r := msg.Message.ButtonsResponseMessage
+		payload.MessageType = "text"
+		payload.Text = r.GetSelectedDisplayText()
+		payload.Selection = &store.Selection{Type: "button", ID: r.GetSelectedButtonID(), Title: r.GetSelectedDisplayText()}
+		payload.ReplyToMessageID = r.GetContextInfo().GetStanzaID()
+	case msg.Message.ListResponseMessage != nil:
+		r := msg.Message.ListResponseMessage
+		payload.MessageType = "text"
+		payload.Text = r.GetTitle()
+		payload.Selection = &store.Selection{Type: "list", ID: r.GetSingleSelectReply().GetSelectedRowID(), Title: r.GetTitle()}
+		payload.ReplyToMessageID = r.GetContextInfo().GetStanzaID()
+	case msg.Message.TemplateButtonReplyMessage != nil:
+		r := msg.Message.TemplateButtonReplyMessage
+		payload.MessageType = "text"
+		payload.Text = r.GetSelectedDisplayText()
+		payload.Selection = &store.Selection{Type: "template_button", ID: r.GetSelectedID(), Title: r.GetSelectedDisplayText()}
+		payload.ReplyToMessageID = r.GetContextInfo().GetStanzaID()
+	case msg.Message.InteractiveResponseMessage != nil:
+		r := msg.Message.InteractiveResponseMessage
+		payload.MessageType = "text"
+		payload.Text = r.GetBody().GetText()
+		payload.Selection = store.NativeFlowSelection(r.GetBody().GetText(), r.GetNativeFlowResponseMessage().GetParamsJSON())
+		payload.ReplyToMessageID = r.GetContextInfo().GetStanzaID()
+	case wamsg.PollCreation(msg.Message) != nil:
+		pc := wamsg.PollCreation(msg.Message)
+		payload.MessageType = "poll"
+		payload.Poll = wamsg.Poll(pc)
+		payload.Text = pc.GetName()
+		payload.ReplyToMessageID = pc.GetContextInfo().GetStanzaID()
 	default:
 		payload.MessageType = "other"
 	}
 
+	if payload.MessageType == "media" {
+		if info := media.FromMessage(msg); info != nil {
+			keys, meta := info.Keys(), info.Meta()
+			payload.MediaKeys = &keys
+			payload.Media = &meta
+		}
+	}
+
 	return payload
 }
 
@@ -292,10 +420,19 @@ func handleMessageEdit(client *whatsmeow.Client, db *store.Store, msg *events.Me
 		return
 	}
 
-	chatID := resolveChatJID(client, msg.Info.Chat).String()
-	if proto.GetKey().GetRemoteJID() != "" {
-		chatID = proto.GetKey().GetRemoteJID()
+	// Rows are stored under the event's resolved chat. The key's remote JID
+	// can name a LID chat or, when the other party revokes in a 1:1 chat,
+	// ourselves, so it is only a fallback.
+	chatJID := msg.Info.Chat
+	if chatJID.IsEmpty() {
+		keyJID, err := types.ParseJID(proto.GetKey().GetRemoteJID())
+		if err != nil || keyJID.IsEmpty() {
+			log.Warn().Str("target_message_id", targetID).Msg("revoke protocol message has no chat")
+			return
+		}
+		chatJID = keyJID
 	}
+	chatID := resolveChatJID(client, chatJID).String()
 
 	edited := proto.GetEditedMessage()
 	if edited == nil {
@@ -331,59 +468,91 @@ func handleMessageEdit(client *whatsmeow.Client, db *store.Store, msg *events.Me
 	}
 }
 
-// handleMedia downloads the attachment, forwards it to the appropriate webhook
-// (voice or image), and — when storage is configured — uploads it to Supabase
-// Storage and updates the message record with the resulting path.
-func handleMedia(client *whatsmeow.Client, cfg config.Config, db *store.Store, msg *events.Message, payload store.MessagePayload) {
-	pipelineStart := time.Now()
-
-	info := media.FromMessage(msg)
-	if info == nil {
+// handleRevoke processes a REVOKE protocol message ("deleted for everyone") by
+// marking the target message as revoked and notifying the message webhook.
+func handleRevoke(client *whatsmeow.Client, cfg config.Config, db *store.Store, msg *events.Message, proto *waE2E.ProtocolMessage) {
+	targetID := proto.GetKey().GetID()
+	if targetID == "" {
+		log.Warn().Msg("revoke protocol message has no target message ID")
 		return
 	}
 
-	dlStart := time.Now()
-	data, err := client.Download(context.Background(), info.Downloadable)
-	metrics.MediaDownloadDuration.WithLabelValues(payload.MediaType).Observe(time.Since(dlStart).Seconds())
-	if err != nil {
-		log.Error().Err(err).Str("message_id", payload.MessageID).Msg("failed to download media")
-		return
+	// Rows are stored under the event's resolved chat. The key's remote JID
+	// can name a LID chat or, when the other party revokes in a 1:1 chat,
+	// ourselves, so it is only a fallback.
+	chatJID := msg.Info.Chat
+	if chatJID.IsEmpty() {
+		keyJID, err := types.ParseJID(proto.GetKey().GetRemoteJID())
+		if err != nil || keyJID.IsEmpty() {
+			log.Warn().Str("target_message_id", targetID).Msg("revoke protocol message has no chat")
+			return
+		}
+		chatJID = keyJID
 	}
+	chatID := resolveChatJID(client, chatJID).String()
 
-	// Forward to voice webhook if audio.
-	if payload.MediaType == "audio" && cfg.VoiceWebhookURL != "" {
-		go webhook.SendVoice(cfg.VoiceWebhookURL,
-			payload.SenderID, payload.SenderName, payload.ChatID,
-			payload.MessageID, payload.IsGroup, data)
+	revokedAt := msg.Info.Timestamp
+	if tsMS := proto.GetTimestampMS(); tsMS > 0 {
+		revokedAt = time.UnixMilli(tsMS)
 	}
 
-	// Forward to image webhook if image.
-	if payload.MediaType == "image" && cfg.ImageWebhookURL != "" {
-		go webhook.SendImage(cfg.ImageWebhookURL,
-			payload.SenderID, payload.SenderName, payload.ChatID,
-			payload.MessageID, payload.IsGroup, data, info.MimeType)
+	updated, err := db.RevokeMessage(context.Background(), targetID, chatID, revokedAt)
+	if err != nil {
+		log.Error().Err(err).Str("target_message_id", targetID).Msg("failed to apply message revoke")
+		return
 	}
+	if !updated {
+		log.Debug().Str("target_message_id", targetID).Str("chat_id", chatID).Msg("revoked message not stored or already revoked")
+		return
+	}
+	log.Debug().Str("target_message_id", targetID).Msg("message revoke applied")
+
+	if cfg.WebhookURL != "" {
+		go webhook.SendText(cfg.WebhookURL, store.MessagePayload{
+			Timestamp:   revokedAt,
+			MessageID:   targetID,
+			ChatID:      chatID,
+			SenderID:    resolveSender(msg),
+			SenderName:  msg.Info.PushName,
+			MessageType: "revoked",
+			IsGroup:     msg.Info.IsGroup,
+			IsFromMe:    msg.Info.IsFromMe,
+		})
+	}
+}
 
-	// Upload to storage if configured.
-	if cfg.StorageConfigured() {
-		ext := media.MimeToExt(info.MimeType)
-		mediaPath := fmt.Sprintf("%s/%s.%s", payload.ChatID, payload.MessageID, ext)
-
-		ulStart := time.Now()
-		if err := media.UploadToSupabase(data, cfg.SupabaseURL, cfg.SupabaseServiceKey, "wa-media", mediaPath, info.MimeType); err != nil {
-			metrics.MediaUploadDuration.Observe(time.Since(ulStart).Seconds())
-			log.Error().Err(err).Str("message_id", payload.MessageID).Str("media_path", mediaPath).Msg("failed to upload media")
-			return
-		}
-		metrics.MediaUploadDuration.Observe(time.Since(ulStart).Seconds())
+// handleMedia hands the attachment to the media pipeline, which stores it
+// when storage is configured, and forwards the downloaded file to the
+// appropriate webhook (voice or image).
+func handleMedia(cfg config.Config, pipeline *media.Pipeline, payload store.MessagePayload) {
+	target, ok := payload.MediaTarget()
+	if !ok {
+		return
+	}
 
-		if err := db.UpdateMediaPath(payload.MessageID, payload.ChatID, mediaPath); err != nil {
-			log.Error().Err(err).Str("message_id", payload.MessageID).Str("media_path", mediaPath).Msg("failed to update media_path")
-			return
+	var webhookURL string
+	switch payload.MediaType {
+	case "audio":
+		webhookURL = cfg.VoiceWebhookURL
+	case "image":
+		webhookURL = cfg.ImageWebhookURL
+	}
+	var use func(src io.ReaderAt, size int64)
+	if webhookURL != "" {
+		use = func(src io.ReaderAt, size int64) {
+			if payload.MediaType == "audio" {
+				webhook.SendVoice(webhookURL,
+					payload.SenderID, payload.SenderName, payload.ChatID,
+					payload.MessageID, payload.IsGroup, io.NewSectionReader(src, 0, size))
+			} else {
+				webhook.SendImage(webhookURL,
+					payload.SenderID, payload.SenderName, payload.ChatID,
+					payload.MessageID, payload.IsGroup, io.NewSectionReader(src, 0, size), target.Keys.MimeType)
+			}
 		}
-
-		log.Debug().Str("media_path", mediaPath).Msg("media stored")
 	}
 
-	metrics.MediaPipelineDuration.WithLabelValues(payload.MediaType).Observe(time.Since(pipelineStart).Seconds())
+	if _, err := pipeline.Fetch(context.Background(), target, use); err != nil && !errors.Is(err, media.ErrTooLarge) {
+		log.Error().Err(err).Str("message_id", payload.MessageID).Msg("failed to store media")
+	}
 }
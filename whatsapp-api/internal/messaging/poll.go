@@ -0,0 +1,89 @@
+package messaging
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/store"
+	"whatsapp-bridge/internal/waclient"
+)
+
+// handlePollVote decrypts a poll vote, resolves the selected option hashes
+// against the stored poll, and records the voter's selection. When a customer
+// picks a single option linked to a quote, that quote option is marked as
+// selected.
+func handlePollVote(client *whatsmeow.Client, db *store.Store, msg *events.Message, update *waE2E.PollUpdateMessage) {
+	ctx := context.Background()
+
+	pollID := update.GetPollCreationMessageKey().GetID()
+	chatID := resolveChatJID(client, msg.Info.Chat).String()
+
+	vote, err := client.DecryptPollVote(ctx, msg)
+	if err != nil {
+		log.Error().Err(err).Str("poll_message_id", pollID).Str("chat_id", chatID).Msg("failed to decrypt poll vote")
+		metrics.PollVoteTotal.WithLabelValues("decrypt_error").Inc()
+		return
+	}
+
+	poll, err := db.GetPoll(ctx, chatID, pollID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Warn().Str("poll_message_id", pollID).Str("chat_id", chatID).Msg("vote for unknown poll")
+			metrics.PollVoteTotal.WithLabelValues("unknown_poll").Inc()
+			return
+		}
+		log.Error().Err(err).Str("poll_message_id", pollID).Msg("failed to look up poll")
+		metrics.PollVoteTotal.WithLabelValues("db_error").Inc()
+		return
+	}
+
+	// Votes carry SHA-256 hashes of the option names rather than the names.
+	hashes := whatsmeow.HashPollOptions(poll.Options)
+	var selected []string
+	var selectedIdx []int
+	for _, h := range vote.GetSelectedOptions() {
+		for i, optionHash := range hashes {
+			if bytes.Equal(h, optionHash) {
+				selected = append(selected, poll.Options[i])
+				selectedIdx = append(selectedIdx, i)
+				break
+			}
+		}
+	}
+
+	// Key votes by the member who cast them; resolveSender would give the
+	// group for every vote in a group poll.
+	senderPN := msg.Info.SenderAlt
+	if senderPN.Server != types.DefaultUserServer {
+		senderPN = types.EmptyJID
+	}
+	voterID := waclient.ParticipantID(ctx, client, msg.Info.Sender, senderPN)
+	if err := db.UpsertPollVote(ctx, pollID, chatID, voterID, msg.Info.PushName, selected, msg.Info.Timestamp); err != nil {
+		log.Error().Err(err).Str("poll_message_id", pollID).Msg("failed to save poll vote")
+		metrics.PollVoteTotal.WithLabelValues("db_error").Inc()
+		return
+	}
+	metrics.PollVoteTotal.WithLabelValues("saved").Inc()
+
+	log.Debug().Str("poll_message_id", pollID).Str("voter_id", voterID).Strs("selected", selected).Msg("poll vote saved")
+
+	if msg.Info.IsFromMe || len(selectedIdx) != 1 || selectedIdx[0] >= len(poll.QuoteOptionIDs) {
+		return
+	}
+	quoteOptionID := poll.QuoteOptionIDs[selectedIdx[0]]
+	if quoteOptionID == "" {
+		return
+	}
+	if err := db.SelectQuoteOption(ctx, quoteOptionID); err != nil {
+		log.Error().Err(err).Str("quote_option_id", quoteOptionID).Msg("failed to select quote option from poll vote")
+		return
+	}
+	log.Info().Str("poll_message_id", pollID).Str("quote_option_id", quoteOptionID).Msg("quote option selected by poll vote")
+}
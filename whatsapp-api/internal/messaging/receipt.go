@@ -0,0 +1,58 @@
+package messaging
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+	"go.mau.fi/whatsmeow/types/events"
+
+	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/store"
+)
+
+// receiptStatus maps a whatsmeow receipt type to the delivery_status stored on
+// messages. Receipts that say nothing about a recipient seeing our message
+// (our own devices, retries, sender receipts) map to "".
+func receiptStatus(t types.ReceiptType) string {
+	switch t {
+	case types.ReceiptTypeDelivered:
+		return "delivered"
+	case types.ReceiptTypeRead:
+		return "read"
+	case types.ReceiptTypePlayed:
+		return "played"
+	default:
+		return ""
+	}
+}
+
+// handleReceipt records delivered/read/played receipts from recipients on the
+// messages we sent.
+func handleReceipt(client *whatsmeow.Client, db *store.Store, evt *events.Receipt) {
+	// Receipts from our own devices report that *we* read someone else's
+	// message; only recipients' receipts describe delivery of ours.
+	if evt.IsFromMe {
+		return
+	}
+
+	status := receiptStatus(evt.Type)
+	if status == "" || len(evt.MessageIDs) == 0 {
+		return
+	}
+
+	chatID := resolveChatJID(client, evt.Chat).String()
+	ids := make([]string, len(evt.MessageIDs))
+	for i, id := range evt.MessageIDs {
+		ids[i] = string(id)
+	}
+
+	if err := db.ApplyReceipt(context.Background(), chatID, ids, status, evt.Timestamp); err != nil {
+		log.Error().Err(err).Str("chat_id", chatID).Str("status", status).Strs("message_ids", ids).Msg("failed to apply receipt")
+		metrics.ReceiptTotal.WithLabelValues(status, "error").Inc()
+		return
+	}
+
+	metrics.ReceiptTotal.WithLabelValues(status, "success").Inc()
+	log.Debug().Str("chat_id", chatID).Str("status", status).Int("count", len(ids)).Msg("receipt applied")
+}
@@ -27,6 +27,27 @@ var IncomingMessageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 	Buckets: fastBuckets,
 }, []string{"message_type"})
 
+// --- Receipts ---
+
+var ReceiptTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "wabridge_receipt_total",
+	Help: "Total delivery/read/played receipts applied to sent messages.",
+}, []string{"status", "result"})
+
+// --- Calls ---
+
+var CallEventTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "wabridge_call_event_total",
+	Help: "Total call events handled (offer, accept, terminate, reject).",
+}, []string{"event"})
+
+// --- Polls ---
+
+var PollVoteTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "wabridge_poll_vote_total",
+	Help: "Total incoming poll votes by result.",
+}, []string{"result"})
+
 // --- Media pipeline ---
 
 var MediaDownloadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
@@ -37,16 +58,51 @@ var MediaDownloadDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 
 var MediaUploadDuration = promauto.NewHistogram(prometheus.HistogramOpts{
 	Name:    "wabridge_media_upload_duration_seconds",
-	Help:    "Duration of Supabase Storage uploads.",
+	Help:    "Duration of media storage uploads.",
 	Buckets: slowBuckets,
 })
 
+var MediaDedupTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "wabridge_media_dedup_total",
+	Help: "Total media files stored by result (uploaded, reused: same content already stored).",
+}, []string{"result"})
+
+var MediaThumbnailTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "wabridge_media_thumbnail_total",
+	Help: "Total thumbnails stored by source (embedded, image, pdf).",
+}, []string{"source"})
+
+var MediaTooLargeTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "wabridge_media_too_large_total",
+	Help: "Total attachments not downloaded because they exceed the size limit.",
+}, []string{"media_type"})
+
+var MediaRetentionTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "wabridge_media_retention_total",
+	Help: "Total media files removed by the retention policy, by action (deleted/archived/failed).",
+}, []string{"action"})
+
 var MediaPipelineDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
 	Name:    "wabridge_media_pipeline_duration_seconds",
 	Help:    "Duration of the full media flow (download + upload).",
 	Buckets: slowBuckets,
 }, []string{"media_type"})
 
+var HistoryMediaTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "wabridge_history_media_total",
+	Help: "Total background media downloads (history sync, retry sweep, retry_media) by result (stored, skipped, failed).",
+}, []string{"result"})
+
+var HistoryMediaQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "wabridge_history_media_queue_depth",
+	Help: "Background media downloads waiting for a worker.",
+})
+
+var MediaRetryTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "wabridge_media_retry_total",
+	Help: "Total media retry receipts sent to the phone by result.",
+}, []string{"result"})
+
 // --- Outbox ---
 
 var OutboxProcessDuration = promauto.NewHistogram(prometheus.HistogramOpts{
@@ -103,7 +159,7 @@ var WebhookTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 	Help: "Total webhook call outcomes.",
 }, []string{"type", "result"})
 
-// --- Group name resolution ---
+// --- Groups ---
 
 var GroupResolveDuration = promauto.NewHistogram(prometheus.HistogramOpts{
 	Name:    "wabridge_group_resolve_duration_seconds",
@@ -116,6 +172,28 @@ var GroupResolveTotal = promauto.NewCounterVec(prometheus.CounterOpts{
 	Help: "Total group name resolution outcomes.",
 }, []string{"result"})
 
+var GroupEventTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "wabridge_group_event_total",
+	Help: "Total group metadata and membership changes applied.",
+}, []string{"change"})
+
+// --- History sync ---
+
+var HistorySyncChunkTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "wabridge_history_sync_chunk_total",
+	Help: "Total history sync chunks received by sync type.",
+}, []string{"sync_type"})
+
+var HistorySyncItemsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "wabridge_history_sync_items_total",
+	Help: "Total items saved from history syncs by sync type and kind (conversation, message, push_name).",
+}, []string{"sync_type", "kind"})
+
+var HistorySyncProgress = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "wabridge_history_sync_progress",
+	Help: "Progress percentage reported by the latest history sync chunk.",
+}, []string{"sync_type"})
+
 // --- WhatsApp send (cross-cutting) ---
 
 var WASendDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
@@ -0,0 +1,35 @@
+package outbox
+
+import (
+	"context"
+
+	waProto "go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-bridge/internal/store"
+)
+
+// withChatExpiration marks msg as ephemeral when the chat has disappearing
+// messages turned on, so it expires on the recipient's phone like the rest of
+// the conversation. A failed lookup is logged and the message is sent as is.
+func withChatExpiration(ctx context.Context, db *store.Store, chatJID types.JID, msg *waProto.Message) *waProto.Message {
+	expiration, err := db.ChatEphemeralExpiration(ctx, chatJID.String())
+	if err != nil {
+		log.Error().Err(err).Str("chat_id", chatJID.String()).Msg("failed to look up ephemeral timer")
+		return msg
+	}
+	if expiration == 0 {
+		return msg
+	}
+
+	msg, slot := contextInfoSlot(msg)
+	if slot == nil {
+		return msg
+	}
+	if *slot == nil {
+		*slot = &waProto.ContextInfo{}
+	}
+	(*slot).Expiration = proto.Uint32(expiration)
+	return msg
+}
@@ -0,0 +1,85 @@
+package outbox
+
+import (
+	"encoding/json"
+	"fmt"
+
+	waProto "go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-bridge/internal/store"
+)
+
+// maxReplyButtons is the most reply buttons WhatsApp renders on a buttons
+// message.
+const maxReplyButtons = 3
+
+// buildInteractiveMessage returns the buttons or list message described by an
+// outbox row's interactive JSON, with body as its text. whatsmeow adds the
+// "biz" node these messages need when sending.
+func buildInteractiveMessage(raw json.RawMessage, body string) (*waProto.Message, error) {
+	var im store.Interactive
+	if err := json.Unmarshal(raw, &im); err != nil {
+		return nil, fmt.Errorf("invalid interactive: %w", err)
+	}
+
+	var footer *string
+	if im.Footer != "" {
+		footer = proto.String(im.Footer)
+	}
+
+	switch im.Type {
+	case "buttons":
+		if len(im.Buttons) == 0 || len(im.Buttons) > maxReplyButtons {
+			return nil, fmt.Errorf("buttons message needs 1 to %d buttons, got %d", maxReplyButtons, len(im.Buttons))
+		}
+		buttons := make([]*waProto.ButtonsMessage_Button, 0, len(im.Buttons))
+		for _, b := range im.Buttons {
+			buttons = append(buttons, &waProto.ButtonsMessage_Button{
+				ButtonID:   proto.String(b.ID),
+				ButtonText: &waProto.ButtonsMessage_Button_ButtonText{DisplayText: proto.String(b.Title)},
+				Type:       waProto.ButtonsMessage_Button_RESPONSE.Enum(),
+			})
+		}
+		return &waProto.Message{ButtonsMessage: &waProto.ButtonsMessage{
+			ContentText: proto.String(body),
+			FooterText:  footer,
+			Buttons:     buttons,
+			HeaderType:  waProto.ButtonsMessage_EMPTY.Enum(),
+		}}, nil
+
+	case "list":
+		if len(im.Sections) == 0 {
+			return nil, fmt.Errorf("list message needs at least one section")
+		}
+		if im.ButtonText == "" {
+			return nil, fmt.Errorf("list message needs button_text")
+		}
+		sections := make([]*waProto.ListMessage_Section, 0, len(im.Sections))
+		for _, sec := range im.Sections {
+			rows := make([]*waProto.ListMessage_Row, 0, len(sec.Rows))
+			for _, r := range sec.Rows {
+				row := &waProto.ListMessage_Row{RowID: proto.String(r.ID), Title: proto.String(r.Title)}
+				if r.Description != "" {
+					row.Description = proto.String(r.Description)
+				}
+				rows = append(rows, row)
+			}
+			section := &waProto.ListMessage_Section{Rows: rows}
+			if sec.Title != "" {
+				section.Title = proto.String(sec.Title)
+			}
+			sections = append(sections, section)
+		}
+		return &waProto.Message{ListMessage: &waProto.ListMessage{
+			Description: proto.String(body),
+			ButtonText:  proto.String(im.ButtonText),
+			ListType:    waProto.ListMessage_SINGLE_SELECT.Enum(),
+			Sections:    sections,
+			FooterText:  footer,
+		}}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported interactive type %q", im.Type)
+	}
+}
@@ -0,0 +1,183 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/proto/waE2E"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-bridge/internal/media"
+	"whatsapp-bridge/internal/store"
+)
+
+// outgoingMedia is an attachment fetched from storage for an outbox message.
+type outgoingMedia struct {
+	mediaType string
+	mimeType  string
+	data      []byte
+	sha256    []byte
+}
+
+// buildMediaMessage downloads the outbox attachment from media storage,
+// uploads it to WhatsApp, and returns the matching media message.
+func (l *Listener) buildMediaMessage(ctx context.Context, msg *store.OutboxMessage) (*waProto.Message, *outgoingMedia, error) {
+	if l.storage == nil {
+		return nil, nil, errors.New("media storage not configured")
+	}
+
+	data, contentType, err := l.storage.Download(ctx, msg.MediaBucket, msg.MediaPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("downloading %s/%s: %w", msg.MediaBucket, msg.MediaPath, err)
+	}
+
+	mimeType := resolveMimeType(msg, contentType)
+	mediaType := msg.MediaType
+	if mediaType == "" {
+		mediaType = mediaTypeForMime(mimeType)
+	}
+
+	var appInfo whatsmeow.MediaType
+	switch mediaType {
+	case "image":
+		appInfo = whatsmeow.MediaImage
+	case "video":
+		appInfo = whatsmeow.MediaVideo
+	case "audio":
+		appInfo = whatsmeow.MediaAudio
+	case "document":
+		appInfo = whatsmeow.MediaDocument
+	default:
+		return nil, nil, fmt.Errorf("unsupported media_type %q", mediaType)
+	}
+
+	up, err := l.client.Upload(ctx, data, appInfo)
+	if err != nil {
+		return nil, nil, fmt.Errorf("uploading to WhatsApp: %w", err)
+	}
+
+	var caption *string
+	if msg.Content != "" {
+		caption = proto.String(msg.Content)
+	}
+
+	waMsg := &waProto.Message{}
+	switch mediaType {
+	case "image":
+		waMsg.ImageMessage = &waProto.ImageMessage{
+			Caption:       caption,
+			Mimetype:      proto.String(mimeType),
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+		}
+	case "video":
+		waMsg.VideoMessage = &waProto.VideoMessage{
+			Caption:       caption,
+			Mimetype:      proto.String(mimeType),
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+		}
+	case "audio":
+		// Ogg/Opus audio is what WhatsApp records for voice notes, so send it
+		// as push-to-talk to get the voice note UI on the customer's phone.
+		waMsg.AudioMessage = &waProto.AudioMessage{
+			Mimetype:      proto.String(mimeType),
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+			PTT:           proto.Bool(strings.HasPrefix(mimeType, "audio/ogg")),
+		}
+	case "document":
+		fileName := msg.MediaFilename
+		if fileName == "" {
+			fileName = path.Base(msg.MediaPath)
+		}
+		waMsg.DocumentMessage = &waProto.DocumentMessage{
+			Caption:       caption,
+			Title:         proto.String(fileName),
+			FileName:      proto.String(fileName),
+			Mimetype:      proto.String(mimeType),
+			URL:           proto.String(up.URL),
+			DirectPath:    proto.String(up.DirectPath),
+			MediaKey:      up.MediaKey,
+			FileEncSHA256: up.FileEncSHA256,
+			FileSHA256:    up.FileSHA256,
+			FileLength:    proto.Uint64(up.FileLength),
+		}
+	}
+
+	return waMsg, &outgoingMedia{mediaType: mediaType, mimeType: mimeType, data: data, sha256: up.FileSHA256}, nil
+}
+
+// storeSentMedia returns the wa-media path the sent message should point at.
+// Attachments from other buckets are copied into wa-media, deduplicated by
+// content, so the chat view can render them like received media; the copy's
+// blob is returned too. Returns "" if the copy fails.
+func (l *Listener) storeSentMedia(ctx context.Context, msg *store.OutboxMessage, m *outgoingMedia) (string, *store.MediaBlob) {
+	if msg.MediaBucket == media.DefaultBucket {
+		return msg.MediaPath, nil
+	}
+
+	var fileName string
+	if m.mediaType == "document" {
+		fileName = msg.MediaFilename
+		if fileName == "" {
+			fileName = path.Base(msg.MediaPath)
+		}
+	}
+	blob, err := media.StoreBlob(ctx, l.storage, l.db, bytes.NewReader(m.data), int64(len(m.data)), m.sha256, fileName, m.mimeType)
+	if err != nil {
+		log.Error().Err(err).Int64("outbox_id", msg.ID).Msg("failed to copy sent media to wa-media")
+		return "", nil
+	}
+	return blob.Path, &blob
+}
+
+// resolveMimeType picks the MIME type for an outgoing attachment: the value on
+// the outbox row, then the Content-Type reported by storage, then a guess from
+// the file extension.
+func resolveMimeType(msg *store.OutboxMessage, contentType string) string {
+	if msg.MediaMimeType != "" {
+		return msg.MediaMimeType
+	}
+	if contentType != "" && contentType != "application/octet-stream" {
+		return contentType
+	}
+	if byExt := mime.TypeByExtension(path.Ext(msg.MediaPath)); byExt != "" {
+		return byExt
+	}
+	return "application/octet-stream"
+}
+
+// mediaTypeForMime maps a MIME type to the outbox media_type used when the row
+// does not specify one. Anything that is not an image, video or audio file is
+// sent as a document.
+func mediaTypeForMime(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	default:
+		return "document"
+	}
+}
@@ -1,9 +1,12 @@
 // Package outbox implements the LISTEN/NOTIFY outbox pattern for outgoing
 // WhatsApp messages. A Postgres channel signals new rows in
-// wa_bridge.outgoing_messages; this package claims and sends them.
+// wa_bridge.outgoing_messages; this package claims and sends them, holding
+// scheduled rows until their send_at and retrying transient failures with
+// exponential backoff.
 package outbox
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
@@ -17,24 +20,52 @@ import (
 
 	"go.mau.fi/whatsmeow"
 
+	"whatsapp-bridge/internal/config"
 	"whatsapp-bridge/internal/logging"
+	"whatsapp-bridge/internal/media"
 	"whatsapp-bridge/internal/metrics"
 	"whatsapp-bridge/internal/store"
 )
 
 var log = logging.Component("outbox")
 
+// Listener claims and sends outgoing messages from the database.
+type Listener struct {
+	client      *whatsmeow.Client
+	db          *store.Store
+	databaseURL string
+	maxAttempts int
+
+	storage media.Storage
+
+	// wake nudges the scheduler to re-evaluate the next due row.
+	wake chan struct{}
+}
+
+// New creates a new outbox Listener.
+func New(client *whatsmeow.Client, db *store.Store, cfg config.Config, storage media.Storage) *Listener {
+	return &Listener{
+		client:      client,
+		db:          db,
+		databaseURL: cfg.DatabaseURL,
+		maxAttempts: cfg.OutboxMaxAttempts,
+		wake:        make(chan struct{}, 1),
+		storage:     storage,
+	}
+}
+
 // Listen subscribes to the new_outgoing_message Postgres channel and processes
 // outgoing messages as they arrive. It also drains any messages that were
-// pending before the listener started. Blocks until ctx is cancelled.
-func Listen(ctx context.Context, client *whatsmeow.Client, db *store.Store, databaseURL string) {
+// pending before the listener started and runs the scheduler for delayed and
+// retried rows. Blocks until ctx is cancelled.
+func (l *Listener) Listen(ctx context.Context) {
 	reportProblem := func(ev pq.ListenerEventType, err error) {
 		if err != nil {
 			log.Error().Err(err).Msg("listener error")
 		}
 	}
 
-	listener := pq.NewListener(databaseURL, 10*time.Second, time.Minute, reportProblem)
+	listener := pq.NewListener(l.databaseURL, 10*time.Second, time.Minute, reportProblem)
 	if err := listener.Listen("new_outgoing_message"); err != nil {
 		log.Error().Err(err).Msg("failed to LISTEN on new_outgoing_message")
 		return
@@ -42,7 +73,9 @@ func Listen(ctx context.Context, client *whatsmeow.Client, db *store.Store, data
 	log.Info().Msg("listening for outgoing messages on new_outgoing_message channel")
 
 	// Drain any messages that arrived before we started listening.
-	processPending(ctx, client, db)
+	l.processPending(ctx)
+
+	go l.runScheduler(ctx)
 
 	for {
 		select {
@@ -53,7 +86,7 @@ func Listen(ctx context.Context, client *whatsmeow.Client, db *store.Store, data
 			if n == nil {
 				// nil notification signals a reconnect — re-drain pending.
 				log.Info().Msg("listener reconnected, checking pending messages")
-				processPending(ctx, client, db)
+				l.processPending(ctx)
 				continue
 			}
 			var payload struct {
@@ -63,32 +96,36 @@ func Listen(ctx context.Context, client *whatsmeow.Client, db *store.Store, data
 				log.Error().Err(err).Msg("failed to parse outbox notification")
 				continue
 			}
-			go processOne(ctx, client, db, payload.ID)
+			// Rows scheduled for later are skipped by processOne; let the
+			// scheduler account for their send_at.
+			l.wakeScheduler()
+			go l.processOne(ctx, payload.ID)
 		}
 	}
 }
 
-func processPending(ctx context.Context, client *whatsmeow.Client, db *store.Store) {
-	ids, err := db.PendingOutboxIDs(ctx)
+func (l *Listener) processPending(ctx context.Context) {
+	ids, err := l.db.PendingOutboxIDs(ctx)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to query pending outbox")
 		return
 	}
 	for _, id := range ids {
-		processOne(ctx, client, db, id)
+		l.processOne(ctx, id)
 	}
 	if len(ids) > 0 {
 		log.Info().Int("count", len(ids)).Msg("processed pending outbox messages")
 	}
 }
 
-func processOne(ctx context.Context, client *whatsmeow.Client, db *store.Store, id int64) {
+func (l *Listener) processOne(ctx context.Context, id int64) {
 	start := time.Now()
 
-	chatID, content, err := db.ClaimOutboxMessage(ctx, id)
+	msg, err := l.db.ClaimOutboxMessage(ctx, id)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			// Already claimed by another instance or no longer pending.
+			// Already claimed by another instance, no longer pending,
+			// scheduled for later, or waiting for a retry.
 			return
 		}
 		log.Error().Err(err).Int64("outbox_id", id).Msg("failed to claim outbox message")
@@ -97,47 +134,72 @@ func processOne(ctx context.Context, client *whatsmeow.Client, db *store.Store,
 		return
 	}
 
-	jid, err := types.ParseJID(chatID)
+	jid, err := types.ParseJID(msg.ChatID)
 	if err != nil {
-		db.MarkOutboxFailed(ctx, id, fmt.Sprintf("invalid chat_id JID: %v", err))
+		l.db.MarkOutboxFailed(ctx, id, fmt.Sprintf("invalid chat_id JID: %v", err))
 		metrics.OutboxProcessTotal.WithLabelValues("jid_error").Inc()
 		metrics.OutboxProcessDuration.Observe(time.Since(start).Seconds())
 		return
 	}
 
-	msg := &waProto.Message{
-		Conversation: proto.String(content),
+	waMsg, attachment, err := l.buildMessage(ctx, jid, msg)
+	if err != nil {
+		l.handleSendError(ctx, msg, err)
+		metrics.OutboxProcessDuration.Observe(time.Since(start).Seconds())
+		return
 	}
+
 	sendStart := time.Now()
-	resp, err := client.SendMessage(ctx, jid, msg)
+	resp, err := l.client.SendMessage(ctx, jid, waMsg)
 	metrics.OutboxSendDuration.Observe(time.Since(sendStart).Seconds())
 	metrics.WASendDuration.WithLabelValues("outbox").Observe(time.Since(sendStart).Seconds())
 	if err != nil {
-		db.MarkOutboxFailed(ctx, id, fmt.Sprintf("send failed: %v", err))
-		metrics.OutboxProcessTotal.WithLabelValues("send_error").Inc()
+		l.handleSendError(ctx, msg, err)
 		metrics.OutboxProcessDuration.Observe(time.Since(start).Seconds())
 		return
 	}
 
-	if err := db.MarkOutboxSent(ctx, id, resp.ID); err != nil {
+	if err := l.db.MarkOutboxSent(ctx, id, resp.ID); err != nil {
 		log.Error().Err(err).Int64("outbox_id", id).Str("message_id", resp.ID).Msg("failed to mark outbox message as sent")
 	}
 
 	now := time.Now()
 
 	var senderID string
-	if client.Store.ID != nil {
-		senderID = client.Store.ID.User
+	if l.client.Store.ID != nil {
+		senderID = l.client.Store.ID.User
 	}
 
-	db.UpsertOwnContact(ctx, senderID)
+	l.db.UpsertOwnContact(ctx, senderID)
 
-	if err := db.InsertSentMessage(ctx, resp.ID, chatID, senderID, content, now); err != nil {
-		log.Error().Err(err).Str("message_id", resp.ID).Str("chat_id", chatID).Msg("failed to insert sent message")
+	if msg.Location != nil {
+		if err := l.db.InsertSentLocationMessage(ctx, resp.ID, msg.ChatID, senderID, msg.Location, msg.ReplyToMessageID, now); err != nil {
+			log.Error().Err(err).Str("message_id", resp.ID).Str("chat_id", msg.ChatID).Msg("failed to insert sent location message")
+		}
+	} else if msg.Poll != nil {
+		if err := l.db.InsertSentPollMessage(ctx, resp.ID, msg.ChatID, senderID, msg.Poll, msg.ReplyToMessageID, now); err != nil {
+			log.Error().Err(err).Str("message_id", resp.ID).Str("chat_id", msg.ChatID).Msg("failed to insert sent poll message")
+		}
+	} else if attachment != nil {
+		mediaPath, blob := l.storeSentMedia(ctx, msg, attachment)
+		if err := l.db.InsertSentMediaMessage(ctx, resp.ID, msg.ChatID, senderID, msg.Content, attachment.mediaType, mediaPath, msg.ReplyToMessageID, now); err != nil {
+			log.Error().Err(err).Str("message_id", resp.ID).Str("chat_id", msg.ChatID).Msg("failed to insert sent media message")
+		} else if blob != nil {
+			if err := l.db.LinkMessageMedia(ctx, msg.ChatID, resp.ID, blob.SHA256); err != nil {
+				log.Error().Err(err).Str("message_id", resp.ID).Msg("failed to link sent media blob")
+			}
+		}
+		if mediaPath != "" {
+			if _, err := media.StoreThumbnail(ctx, l.storage, l.db, msg.ChatID, resp.ID, attachment.sha256, nil, bytes.NewReader(attachment.data), int64(len(attachment.data)), attachment.mimeType); err != nil {
+				log.Error().Err(err).Str("message_id", resp.ID).Msg("failed to store sent media thumbnail")
+			}
+		}
+	} else if err := l.db.InsertSentMessage(ctx, resp.ID, msg.ChatID, senderID, msg.Content, msg.ReplyToMessageID, now); err != nil {
+		log.Error().Err(err).Str("message_id", resp.ID).Str("chat_id", msg.ChatID).Msg("failed to insert sent message")
 	}
 
-	if err := db.UpdateChatLastMessage(ctx, chatID, now); err != nil {
-		log.Error().Err(err).Str("chat_id", chatID).Msg("failed to update chat last_message_at")
+	if err := l.db.UpdateChatLastMessage(ctx, msg.ChatID, now); err != nil {
+		log.Error().Err(err).Str("chat_id", msg.ChatID).Msg("failed to update chat last_message_at")
 	}
 
 	metrics.OutboxProcessTotal.WithLabelValues("sent").Inc()
@@ -146,6 +208,73 @@ func processOne(ctx context.Context, client *whatsmeow.Client, db *store.Store,
 	log.Info().
 		Int64("outbox_id", id).
 		Str("message_id", resp.ID).
-		Str("chat_id", chatID).
+		Str("chat_id", msg.ChatID).
+		Int("attempts", msg.Attempts).
 		Msg("message sent")
 }
+
+// buildMessage returns the WhatsApp message for an outbox row (text, media,
+// location, poll, or buttons/list), together with the fetched attachment for
+// media rows. The quote is resolved first so a missing reply target fails
+// before any media is transferred. Messages to chats with disappearing
+// messages on carry the chat's expiration.
+func (l *Listener) buildMessage(ctx context.Context, jid types.JID, msg *store.OutboxMessage) (*waProto.Message, *outgoingMedia, error) {
+	var quote *waProto.ContextInfo
+	if msg.ReplyToMessageID != "" {
+		var err error
+		quote, err = buildQuote(ctx, l.client, l.db, jid, msg.ReplyToMessageID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	waMsg := &waProto.Message{Conversation: proto.String(msg.Content)}
+	var attachment *outgoingMedia
+	if msg.Location != nil {
+		waMsg = &waProto.Message{LocationMessage: &waProto.LocationMessage{
+			DegreesLatitude:  proto.Float64(msg.Location.Latitude),
+			DegreesLongitude: proto.Float64(msg.Location.Longitude),
+		}}
+		if msg.Location.Name != "" {
+			waMsg.LocationMessage.Name = proto.String(msg.Location.Name)
+		}
+		if msg.Location.Address != "" {
+			waMsg.LocationMessage.Address = proto.String(msg.Location.Address)
+		}
+	} else if msg.Poll != nil {
+		waMsg = l.client.BuildPollCreation(msg.Content, msg.Poll.Options, msg.Poll.SelectableCount)
+	} else if msg.Interactive != nil {
+		var err error
+		waMsg, err = buildInteractiveMessage(msg.Interactive, msg.Content)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if msg.MediaPath != "" {
+		var err error
+		waMsg, attachment, err = l.buildMediaMessage(ctx, msg)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if quote != nil {
+		waMsg = withQuote(waMsg, quote)
+	}
+	return withChatExpiration(ctx, l.db, jid, waMsg), attachment, nil
+}
+
+// handleSendError either schedules a retry for a transient failure or marks
+// the message as terminally failed once it is permanent or out of attempts.
+func (l *Listener) handleSendError(ctx context.Context, msg *store.OutboxMessage, err error) {
+	if isTransient(err) && msg.Attempts < l.maxAttempts {
+		l.db.MarkOutboxRetry(ctx, msg.ID,
+			fmt.Sprintf("send failed (attempt %d/%d): %v", msg.Attempts, l.maxAttempts, err),
+			time.Now().Add(backoff(msg.Attempts)))
+		metrics.OutboxProcessTotal.WithLabelValues("retry").Inc()
+		l.wakeScheduler()
+		return
+	}
+
+	l.db.MarkOutboxFailed(ctx, msg.ID, fmt.Sprintf("send failed after %d attempt(s): %v", msg.Attempts, err))
+	metrics.OutboxProcessTotal.WithLabelValues("send_error").Inc()
+}
@@ -0,0 +1,129 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go.mau.fi/whatsmeow"
+	waProto "go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/types"
+	"google.golang.org/protobuf/proto"
+
+	"whatsapp-bridge/internal/store"
+)
+
+// ErrQuotedNotFound is returned when reply_to_message_id names a message
+// that is not stored in the chat.
+var ErrQuotedNotFound = errors.New("quoted message not found")
+
+// buildQuote looks up messageID in the given chat and returns the ContextInfo
+// that makes an outgoing message a quoted reply to it.
+func buildQuote(ctx context.Context, client *whatsmeow.Client, db *store.Store, chatJID types.JID, messageID string) (*waProto.ContextInfo, error) {
+	quoted, err := db.GetMessage(ctx, chatJID.String(), messageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: reply_to_message_id %s in chat %s", ErrQuotedNotFound, messageID, chatJID)
+		}
+		return nil, fmt.Errorf("looking up quoted message: %w", err)
+	}
+
+	participant, err := MessageAuthor(client, chatJID, quoted)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the text survives in our database, so quote media by caption or a
+	// short placeholder; recipients resolve the original by stanza ID.
+	text := quoted.Content.String
+	if text == "" && quoted.MediaType.Valid {
+		text = "[" + quoted.MediaType.String + "]"
+	}
+
+	return &waProto.ContextInfo{
+		StanzaID:      proto.String(quoted.MessageID),
+		Participant:   proto.String(participant.String()),
+		QuotedMessage: &waProto.Message{Conversation: proto.String(text)},
+	}, nil
+}
+
+// MessageAuthor returns the JID of a stored message's author: ourselves, the
+// stored sender_jid, or — in 1:1 chats — the other party. Group messages
+// saved before sender_jid was recorded fall back to sender_id as a phone
+// number, unless it only holds the group's own ID.
+func MessageAuthor(client *whatsmeow.Client, chatJID types.JID, msg *store.StoredMessage) (types.JID, error) {
+	switch {
+	case msg.IsFromMe && client.Store.ID != nil:
+		return client.Store.ID.ToNonAD(), nil
+	case msg.SenderJID.Valid && msg.SenderJID.String != "":
+		jid, err := types.ParseJID(msg.SenderJID.String)
+		if err != nil {
+			return types.EmptyJID, fmt.Errorf("invalid sender_jid of message %s: %v", msg.MessageID, err)
+		}
+		return jid, nil
+	case chatJID.Server != types.GroupServer:
+		return chatJID, nil
+	case msg.SenderID.Valid && msg.SenderID.String != "" && msg.SenderID.String != chatJID.User:
+		return types.NewJID(msg.SenderID.String, types.DefaultUserServer), nil
+	default:
+		return types.EmptyJID, fmt.Errorf("sender of group message %s is unknown", msg.MessageID)
+	}
+}
+
+// withQuote attaches a ContextInfo to the content of msg. Plain conversation
+// messages are converted to ExtendedTextMessage, which can carry a quote.
+func withQuote(msg *waProto.Message, quote *waProto.ContextInfo) *waProto.Message {
+	msg, slot := contextInfoSlot(msg)
+	if slot != nil {
+		*slot = quote
+	}
+	return msg
+}
+
+// contextInfoSlot returns msg, with a plain conversation converted to an
+// ExtendedTextMessage, and a pointer to its content's ContextInfo field. The
+// slot is nil for content types that cannot carry a ContextInfo.
+func contextInfoSlot(msg *waProto.Message) (*waProto.Message, **waProto.ContextInfo) {
+	if msg.Conversation != nil {
+		msg = &waProto.Message{ExtendedTextMessage: &waProto.ExtendedTextMessage{
+			Text: msg.Conversation,
+		}}
+	}
+	switch {
+	case msg.ExtendedTextMessage != nil:
+		return msg, &msg.ExtendedTextMessage.ContextInfo
+	case msg.ImageMessage != nil:
+		return msg, &msg.ImageMessage.ContextInfo
+	case msg.VideoMessage != nil:
+		return msg, &msg.VideoMessage.ContextInfo
+	case msg.AudioMessage != nil:
+		return msg, &msg.AudioMessage.ContextInfo
+	case msg.DocumentMessage != nil:
+		return msg, &msg.DocumentMessage.ContextInfo
+	case msg.LocationMessage != nil:
+		return msg, &msg.LocationMessage.ContextInfo
+	case msg.PollCreationMessage != nil:
+		return msg, &msg.PollCreationMessage.ContextInfo
+	case msg.ButtonsMessage != nil:
+		return msg, &msg.ButtonsMessage.ContextInfo
+	case msg.ListMessage != nil:
+		return msg, &msg.ListMessage.ContextInfo
+	}
+	return msg, nil
+}
+
+// BuildTextMessage returns text as a WhatsApp message, quoting
+// replyToMessageID when it is set and matching the chat's disappearing-messages
+// timer.
+func BuildTextMessage(ctx context.Context, client *whatsmeow.Client, db *store.Store, chatJID types.JID, text, replyToMessageID string) (*waProto.Message, error) {
+	msg := &waProto.Message{Conversation: proto.String(text)}
+	if replyToMessageID != "" {
+		quote, err := buildQuote(ctx, client, db, chatJID, replyToMessageID)
+		if err != nil {
+			return nil, err
+		}
+		msg = withQuote(msg, quote)
+	}
+	return withChatExpiration(ctx, db, chatJID, msg), nil
+}
@@ -0,0 +1,44 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"go.mau.fi/whatsmeow"
+)
+
+const (
+	// retryBaseDelay is the wait before the second attempt; each subsequent
+	// attempt doubles it up to retryMaxDelay.
+	retryBaseDelay = 5 * time.Second
+	retryMaxDelay  = 10 * time.Minute
+)
+
+// backoff returns the delay before the next attempt after the given number of
+// failed attempts.
+func backoff(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+	return delay
+}
+
+// isTransient reports whether a send error is likely to succeed on a later
+// attempt (connection drops and timeouts) rather than being permanent. Being
+// logged out is permanent until the device is re-linked, so it is not retried.
+func isTransient(err error) bool {
+	if errors.Is(err, whatsmeow.ErrNotConnected) ||
+		errors.Is(err, whatsmeow.ErrIQTimedOut) ||
+		errors.Is(err, whatsmeow.ErrMessageTimedOut) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,51 @@
+package outbox
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// schedulerIdleInterval bounds how long the scheduler sleeps when nothing
+	// is scheduled, so rows updated outside the bridge are still picked up.
+	schedulerIdleInterval = time.Minute
+	// schedulerMinInterval is the shortest sleep between drains. Due rows that
+	// cannot be claimed (e.g. while the database is failing) keep the earliest
+	// due time in the past; without a floor the loop would spin.
+	schedulerMinInterval = time.Second
+)
+
+// wakeScheduler signals the scheduler without blocking; a pending signal is
+// enough to make it recompute its timer. Called after scheduling a retry and
+// whenever a new row is inserted, since it may carry an earlier send_at.
+func (l *Listener) wakeScheduler() {
+	select {
+	case l.wake <- struct{}{}:
+	default:
+	}
+}
+
+// runScheduler sleeps until the earliest scheduled send or retry is due and
+// then drains all due pending messages. Blocks until ctx is cancelled.
+func (l *Listener) runScheduler(ctx context.Context) {
+	for {
+		wait := schedulerIdleInterval
+		next, err := l.db.NextOutboxDueAt(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to query next outbox due time")
+		} else if next.Valid {
+			wait = min(max(time.Until(next.Time), schedulerMinInterval), schedulerIdleInterval)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-l.wake:
+			timer.Stop()
+		case <-timer.C:
+			l.processPending(ctx)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Package retention expires stored media according to MEDIA_RETENTION. A
+// periodic sweep deletes (or moves to the archive bucket) files older than
+// the configured age for their media type and chat class, skipping anything
+// tagged in public.documents, and marks the message media_status 'expired'.
+//
+// Thumbnails are kept: they are a few KB, let the UI still show what was sent,
+// and are shared by file hash with messages that have no stored file (such as
+// skipped_too_large), so there is no safe point at which to remove them.
+package retention
+
+import (
+	"context"
+	"time"
+
+	"whatsapp-bridge/internal/config"
+	"whatsapp-bridge/internal/logging"
+	"whatsapp-bridge/internal/media"
+	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/store"
+)
+
+var log = logging.Component("retention")
+
+const (
+	// sweepInterval is the time between retention sweeps.
+	sweepInterval = 6 * time.Hour
+	// batchSize bounds how many candidates are fetched per query.
+	batchSize = 500
+)
+
+// mediaTypes are the media_type values retention rules can target.
+var mediaTypes = []string{"image", "video", "audio", "document", "sticker"}
+
+// Sweeper periodically applies the media retention policy.
+type Sweeper struct {
+	db      *store.Store
+	storage media.Storage
+	cfg     config.Config
+}
+
+// New creates a Sweeper. Call Run to start it.
+func New(db *store.Store, storage media.Storage, cfg config.Config) *Sweeper {
+	return &Sweeper{db: db, storage: storage, cfg: cfg}
+}
+
+// Run sweeps once at startup and then every sweepInterval. Blocks until ctx
+// is cancelled.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+	for {
+		s.sweep(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sweep expires everything currently past its retention age.
+func (s *Sweeper) sweep(ctx context.Context) {
+	checkDocuments, err := s.db.HasDocumentsTable(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to check for public.documents, skipping retention sweep")
+		return
+	}
+	if !checkDocuments {
+		// Without the table tagged documents would be expired like any other
+		// media, so only sweep when the operator has opted out of the check.
+		if !s.cfg.MediaRetentionIgnoreDocuments {
+			log.Error().Msg("public.documents missing or not readable, skipping retention sweep (grant access or set MEDIA_RETENTION_IGNORE_DOCUMENTS=true)")
+			return
+		}
+		log.Warn().Msg("public.documents missing or not readable, retention cannot protect tagged documents")
+	}
+
+	for _, mediaType := range mediaTypes {
+		for _, isGroup := range []bool{false, true} {
+			days := s.cfg.MediaRetentionDays(mediaType, isGroup)
+			if days == 0 {
+				continue
+			}
+			before := time.Now().AddDate(0, 0, -days)
+			expired := s.sweepClass(ctx, mediaType, isGroup, before, checkDocuments)
+			if expired > 0 {
+				log.Info().Str("media_type", mediaType).Bool("group", isGroup).
+					Int("days", days).Int("expired", expired).Msg("media retention applied")
+			}
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// sweepClass expires candidates in batches until none are left or a whole
+// batch fails, returning how many messages were expired.
+func (s *Sweeper) sweepClass(ctx context.Context, mediaType string, isGroup bool, before time.Time, checkDocuments bool) int {
+	total := 0
+	for ctx.Err() == nil {
+		candidates, err := s.db.RetentionCandidates(ctx, mediaType, isGroup, before, checkDocuments, batchSize)
+		if err != nil {
+			log.Error().Err(err).Str("media_type", mediaType).Msg("failed to query retention candidates")
+			return total
+		}
+		expired := 0
+		for _, c := range candidates {
+			if err := s.expire(ctx, c); err != nil {
+				metrics.MediaRetentionTotal.WithLabelValues("failed").Inc()
+				log.Error().Err(err).Str("chat_id", c.ChatID).Str("message_id", c.MessageID).
+					Str("path", c.MediaPath).Msg("failed to expire media")
+				continue
+			}
+			expired++
+		}
+		total += expired
+		// Failed rows stay 'stored' and would be returned again; stop rather
+		// than spin on them until the next sweep.
+		if len(candidates) < batchSize || expired == 0 {
+			return total
+		}
+	}
+	return total
+}
+
+// expire removes the candidate's file unless another stored message still
+// uses it, then marks the message expired. thumbnail_path is left alone.
+func (s *Sweeper) expire(ctx context.Context, c store.RetentionCandidate) error {
+	if c.SHA256 != "" {
+		if _, err := s.db.ReleaseMediaBlob(ctx, c.SHA256, c.ChatID, c.MessageID, func(b store.MediaBlob) error {
+			return s.remove(ctx, b.Bucket, b.Path)
+		}); err != nil {
+			return err
+		}
+	} else {
+		shared, err := s.db.MediaPathShared(ctx, c.ChatID, c.MessageID, c.MediaPath)
+		if err != nil {
+			return err
+		}
+		if !shared {
+			if err := s.remove(ctx, media.DefaultBucket, c.MediaPath); err != nil {
+				return err
+			}
+		}
+	}
+	return s.db.ExpireMessageMedia(ctx, c.ChatID, c.MessageID)
+}
+
+// remove deletes an object, first copying it to the archive bucket under the
+// same key when MEDIA_RETENTION_ACTION is archive.
+func (s *Sweeper) remove(ctx context.Context, bucket, key string) error {
+	action := "deleted"
+	if s.cfg.MediaRetentionAction == "archive" {
+		if err := s.storage.Copy(ctx, bucket, key, s.cfg.MediaArchiveBucket, key); err != nil {
+			return err
+		}
+		action = "archived"
+	}
+	if err := s.storage.Delete(ctx, bucket, key); err != nil {
+		return err
+	}
+	metrics.MediaRetentionTotal.WithLabelValues(action).Inc()
+	return nil
+}
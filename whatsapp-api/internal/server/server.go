@@ -4,6 +4,7 @@ package server
 import (
 	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
@@ -14,15 +15,16 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/skip2/go-qrcode"
-	waProto "go.mau.fi/whatsmeow/proto/waE2E"
 	"go.mau.fi/whatsmeow/types"
-	"google.golang.org/protobuf/proto"
 
 	"go.mau.fi/whatsmeow"
 
 	"whatsapp-bridge/internal/agent"
+	"whatsapp-bridge/internal/commands"
 	"whatsapp-bridge/internal/logging"
+	"whatsapp-bridge/internal/media"
 	"whatsapp-bridge/internal/metrics"
+	"whatsapp-bridge/internal/outbox"
 	"whatsapp-bridge/internal/store"
 	"whatsapp-bridge/internal/waclient"
 )
@@ -34,9 +36,18 @@ var templateFS embed.FS
 
 // SendRequest is the JSON body accepted by POST /send.
 type SendRequest struct {
-	Number  string `json:"number" binding:"required"`
-	Text    string `json:"text" binding:"required"`
-	IsGroup bool   `json:"is_group"`
+	Number           string `json:"number" binding:"required"`
+	Text             string `json:"text" binding:"required"`
+	IsGroup          bool   `json:"is_group"`
+	ReplyToMessageID string `json:"reply_to_message_id"`
+}
+
+// ReactRequest is the JSON body accepted by POST /react. An empty emoji
+// removes our reaction.
+type ReactRequest struct {
+	ChatID    string `json:"chat_id" binding:"required"`
+	MessageID string `json:"message_id" binding:"required"`
+	Emoji     string `json:"emoji"`
 }
 
 // UpdateDescriptionRequest is the JSON body accepted by POST /messages/description.
@@ -46,6 +57,17 @@ type UpdateDescriptionRequest struct {
 	Description string `json:"description"`
 }
 
+// SignMediaRequest is the JSON body accepted by POST /media/sign. Bucket
+// defaults to wa-media and ExpiresIn (seconds) to one hour. FileName, the
+// name the download is saved under, defaults to the original name of the
+// message stored at Path.
+type SignMediaRequest struct {
+	Bucket    string `json:"bucket"`
+	Path      string `json:"path" binding:"required"`
+	ExpiresIn int    `json:"expires_in"`
+	FileName  string `json:"file_name"`
+}
+
 // ClaudeRequest is the JSON body accepted by POST /claude.
 type ClaudeRequest struct {
 	SystemPrompt string `json:"system_prompt" binding:"required"`
@@ -53,11 +75,13 @@ type ClaudeRequest struct {
 }
 
 type handler struct {
-	client  *whatsmeow.Client
-	qrStore *waclient.QRStore
-	db      *store.Store
-	agent   *agent.Handler
-	ctx     context.Context
+	client   *whatsmeow.Client
+	qrStore  *waclient.QRStore
+	db       *store.Store
+	storage  media.Storage
+	agent    *agent.Handler
+	commands *commands.Listener
+	ctx      context.Context
 }
 
 func (h *handler) send(c *gin.Context) {
@@ -74,12 +98,19 @@ func (h *handler) send(c *gin.Context) {
 		jid = types.NewJID(req.Number, types.DefaultUserServer)
 	}
 
-	msg := &waProto.Message{
-		Conversation: proto.String(req.Text),
+	msg, err := outbox.BuildTextMessage(h.ctx, h.client, h.db, jid, req.Text, req.ReplyToMessageID)
+	if errors.Is(err, outbox.ErrQuotedNotFound) {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("reply_to_message_id", req.ReplyToMessageID).Msg("failed to build quoted reply")
+		c.String(http.StatusInternalServerError, "failed to build message")
+		return
 	}
 
 	sendStart := time.Now()
-	_, err := h.client.SendMessage(h.ctx, jid, msg)
+	_, err = h.client.SendMessage(h.ctx, jid, msg)
 	metrics.WASendDuration.WithLabelValues("http").Observe(time.Since(sendStart).Seconds())
 	if err != nil {
 		c.String(http.StatusInternalServerError, "failed to send")
@@ -89,6 +120,31 @@ func (h *handler) send(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"status": "sent"})
 }
 
+func (h *handler) react(c *gin.Context) {
+	var req ReactRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.String(http.StatusBadRequest, "chat_id and message_id required")
+		return
+	}
+
+	reactionID, err := h.commands.SendReaction(h.ctx, req.ChatID, req.MessageID, req.Emoji)
+	if errors.Is(err, commands.ErrInvalidReaction) {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, commands.ErrMessageNotFound) {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("chat_id", req.ChatID).Str("message_id", req.MessageID).Msg("failed to send reaction")
+		c.String(http.StatusInternalServerError, "failed to send reaction")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "sent", "reaction_message_id": reactionID})
+}
+
 func (h *handler) health(c *gin.Context) {
 	connected := h.client.IsConnected()
 	loggedIn := h.client.Store.ID != nil
@@ -99,6 +155,59 @@ func (h *handler) health(c *gin.Context) {
 	})
 }
 
+// signMedia returns a time-limited URL for reading a stored media object.
+func (h *handler) signMedia(c *gin.Context) {
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "media storage is not configured"})
+		return
+	}
+	var req SignMediaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "path is required"})
+		return
+	}
+	if req.Bucket == "" {
+		req.Bucket = media.DefaultBucket
+	}
+	if req.ExpiresIn <= 0 {
+		req.ExpiresIn = 3600
+	}
+
+	if req.FileName == "" {
+		name, err := h.db.MediaFileName(c.Request.Context(), req.Path)
+		if err != nil {
+			log.Error().Err(err).Str("path", req.Path).Msg("failed to look up media file name")
+		}
+		req.FileName = name
+	}
+
+	expiry := time.Duration(req.ExpiresIn) * time.Second
+	url, err := h.storage.SignedURL(c.Request.Context(), req.Bucket, req.Path, expiry, req.FileName)
+	if err != nil {
+		log.Error().Err(err).Str("bucket", req.Bucket).Str("path", req.Path).Msg("failed to sign media URL")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": url, "expires_at": time.Now().Add(expiry).UTC()})
+}
+
+// serveLocalMedia serves files from the local storage backend to holders of a
+// signed URL.
+func serveLocalMedia(local *media.LocalStorage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param("path"), "/")
+		file, err := local.Verify(c.Param("bucket"), key, c.Query("expires"), c.Query("sig"))
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		if name := c.Query("name"); name != "" {
+			c.Header("Content-Disposition", media.ContentDisposition(name))
+		}
+		c.File(file)
+	}
+}
+
 func (h *handler) connect(c *gin.Context) {
 	if h.client.Store.ID != nil && h.client.IsConnected() {
 		c.HTML(http.StatusOK, "connected.html", nil)
@@ -230,7 +339,7 @@ func (h *handler) claudeReply(c *gin.Context) {
 
 // Start registers all HTTP routes and begins serving on listenAddr.
 // It runs the HTTP server in a goroutine and returns immediately.
-func Start(ctx context.Context, client *whatsmeow.Client, qrStore *waclient.QRStore, db *store.Store, agentHandler *agent.Handler, listenAddr string) {
+func Start(ctx context.Context, client *whatsmeow.Client, qrStore *waclient.QRStore, db *store.Store, storage media.Storage, agentHandler *agent.Handler, cmdListener *commands.Listener, listenAddr string) {
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
 	r.Use(logging.GinLogger(), logging.GinRecovery())
@@ -241,8 +350,9 @@ func Start(ctx context.Context, client *whatsmeow.Client, qrStore *waclient.QRSt
 	}
 	r.SetHTMLTemplate(tmpl)
 
-	h := &handler{client: client, qrStore: qrStore, db: db, agent: agentHandler, ctx: ctx}
+	h := &handler{client: client, qrStore: qrStore, db: db, storage: storage, agent: agentHandler, commands: cmdListener, ctx: ctx}
 	r.POST("/send", h.send)
+	r.POST("/react", h.react)
 	r.POST("/agent", h.agentHandler)
 	r.GET("/health", h.health)
 	r.GET("/connect", h.connect)
@@ -252,6 +362,10 @@ func Start(ctx context.Context, client *whatsmeow.Client, qrStore *waclient.QRSt
 	r.POST("/disconnect", h.disconnect)
 	r.POST("/claude", h.claudeReply)
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	r.POST("/media/sign", h.signMedia)
+	if local, ok := storage.(*media.LocalStorage); ok {
+		r.GET("/media/:bucket/*path", serveLocalMedia(local))
+	}
 
 	go func() {
 		log.Info().Str("addr", listenAddr).Msg("HTTP server listening")
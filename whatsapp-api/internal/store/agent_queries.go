@@ -260,11 +260,12 @@ func (s *Store) GetBookingSegments(ctx context.Context, bookingID string) ([]Age
 }
 
 // GetChatHistory returns the last N messages from a chat, ordered oldest first.
+// Messages revoked by their sender are excluded.
 func (s *Store) GetChatHistory(ctx context.Context, chatID string, limit int) ([]AgentChatMessage, error) {
 	rows, err := s.db.QueryContext(ctx,
 		`SELECT sender_name, content, is_from_me, is_agent, message_type, media_type, description, timestamp
 		 FROM wa_bridge.messages
-		 WHERE chat_id = $1
+		 WHERE chat_id = $1 AND NOT is_revoked
 		 ORDER BY timestamp DESC
 		 LIMIT $2`,
 		chatID, limit)
@@ -581,8 +582,8 @@ func (s *Store) AddNote(ctx context.Context, targetType, targetID, customerID, n
 // SaveAgentMessage inserts an agent-sent message into wa_bridge.messages.
 func (s *Store) SaveAgentMessage(ctx context.Context, chatID, content, sentMessageID, senderID string, ts time.Time) error {
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO wa_bridge.messages (message_id, chat_id, sender_id, sender_name, message_type, content, is_from_me, is_agent, timestamp)
-		 VALUES ($1, $2, $3, '', 'text', $4, true, true, $5)
+		`INSERT INTO wa_bridge.messages (message_id, chat_id, sender_id, sender_name, message_type, content, is_from_me, is_agent, timestamp, delivery_status)
+		 VALUES ($1, $2, $3, '', 'text', $4, true, true, $5, 'sent')
 		 ON CONFLICT (message_id, chat_id) DO NOTHING`,
 		sentMessageID, chatID, senderID, content, ts)
 	return err
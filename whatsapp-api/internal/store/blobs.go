@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrBlobReleasing is returned for a blob whose file the retention sweep is
+// removing. The blob must not be reused; try again once it is gone.
+var ErrBlobReleasing = errors.New("media blob is being released")
+
+// MediaBlob is a stored media file addressed by the SHA-256 of its content.
+// Messages carrying the same file share one blob via wa_bridge.message_media.
+type MediaBlob struct {
+	SHA256   string // hex
+	Bucket   string
+	Path     string
+	MimeType string
+	Size     int64
+}
+
+// GetMediaBlob looks up a stored blob by its hex SHA-256. Returns
+// sql.ErrNoRows if no file with that content has been stored, and
+// ErrBlobReleasing while retention is removing it.
+func (s *Store) GetMediaBlob(ctx context.Context, sha256 string) (MediaBlob, error) {
+	b := MediaBlob{SHA256: sha256}
+	var releasing bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT bucket, path, COALESCE(mime_type, ''), COALESCE(size, 0), released_at IS NOT NULL
+		 FROM wa_bridge.media_blobs WHERE sha256 = $1`,
+		sha256).Scan(&b.Bucket, &b.Path, &b.MimeType, &b.Size, &releasing)
+	if err == nil && releasing {
+		return MediaBlob{}, ErrBlobReleasing
+	}
+	return b, err
+}
+
+// SaveMediaBlob records a newly uploaded blob. An existing blob with the same
+// hash is kept.
+func (s *Store) SaveMediaBlob(ctx context.Context, b MediaBlob) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.media_blobs (sha256, bucket, path, mime_type, size)
+		 VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, 0))
+		 ON CONFLICT (sha256) DO NOTHING`,
+		b.SHA256, b.Bucket, b.Path, b.MimeType, b.Size)
+	return err
+}
+
+// LinkMessageMedia points a message at the blob holding its attachment.
+// Returns ErrBlobReleasing if retention has started removing the blob.
+func (s *Store) LinkMessageMedia(ctx context.Context, chatID, messageID, sha256 string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockBlobForLink(ctx, tx, sha256); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO wa_bridge.message_media (message_id, chat_id, sha256)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (message_id, chat_id) DO UPDATE SET sha256 = EXCLUDED.sha256`,
+		messageID, chatID, sha256); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockBlobForLink takes a share lock on a blob about to be linked. It
+// conflicts with the lock ReleaseMediaBlob takes, so a blob is either linked
+// before retention checks its references or seen as released here.
+func lockBlobForLink(ctx context.Context, tx *sql.Tx, sha256 string) error {
+	var releasing bool
+	if err := tx.QueryRowContext(ctx,
+		`SELECT released_at IS NOT NULL FROM wa_bridge.media_blobs WHERE sha256 = $1 FOR SHARE`,
+		sha256).Scan(&releasing); err != nil {
+		return fmt.Errorf("lock blob: %w", err)
+	}
+	if releasing {
+		return ErrBlobReleasing
+	}
+	return nil
+}
+
+// SetMessageBlob marks a received attachment as stored in blob: it sets the
+// message's media_path and links the message to the blob. Returns
+// ErrBlobReleasing if retention has started removing the blob.
+func (s *Store) SetMessageBlob(ctx context.Context, chatID, messageID string, b MediaBlob) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := lockBlobForLink(ctx, tx, b.SHA256); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE wa_bridge.messages
+		 SET media_path = $3, media_status = 'stored', media_error = NULL,
+		     media_attempts = media_attempts + 1, media_last_attempt_at = now()
+		 WHERE chat_id = $1 AND message_id = $2`,
+		chatID, messageID, b.Path); err != nil {
+		return fmt.Errorf("update media_path: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO wa_bridge.message_media (message_id, chat_id, sha256)
+		 VALUES ($1, $2, $3)
+		 ON CONFLICT (message_id, chat_id) DO UPDATE SET sha256 = EXCLUDED.sha256`,
+		messageID, chatID, b.SHA256); err != nil {
+		return fmt.Errorf("link blob: %w", err)
+	}
+	return tx.Commit()
+}
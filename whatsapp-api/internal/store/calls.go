@@ -0,0 +1,121 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Call is a voice or video call attempt, stored both in wa_bridge.calls and
+// as a message_type 'call' row in the chat timeline keyed by the call ID.
+// Status is "ringing", "answered", "missed" or "rejected".
+type Call struct {
+	ID              string `json:"call_id"`
+	IsVideo         bool   `json:"is_video"`
+	Status          string `json:"status"`
+	DurationSeconds int    `json:"duration_seconds,omitempty"`
+}
+
+// Text renders the call as timeline content, e.g. "Missed voice call" or
+// "Answered video call (2:15)".
+func (c *Call) Text() string {
+	kind := "voice call"
+	if c.IsVideo {
+		kind = "video call"
+	}
+	switch c.Status {
+	case "answered":
+		if c.DurationSeconds > 0 {
+			return fmt.Sprintf("Answered %s (%d:%02d)", kind, c.DurationSeconds/60, c.DurationSeconds%60)
+		}
+		return "Answered " + kind
+	case "missed":
+		return "Missed " + kind
+	case "rejected":
+		return "Rejected " + kind
+	default:
+		return "Incoming " + kind
+	}
+}
+
+// SaveCallOffer records an incoming call. The timeline row must already exist
+// (see SaveMessage); duplicate offers are ignored.
+func (s *Store) SaveCallOffer(ctx context.Context, chatID, callerID string, call *Call, ts time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.calls (call_id, chat_id, caller_id, is_video, status, offered_at)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (call_id) DO NOTHING`,
+		call.ID, chatID, callerID, call.IsVideo, call.Status, ts)
+	return err
+}
+
+// MarkCallAnswered records that a ringing call was picked up.
+func (s *Store) MarkCallAnswered(ctx context.Context, callID string, ts time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE wa_bridge.calls SET status = 'answered', answered_at = $2
+		 WHERE call_id = $1 AND status = 'ringing'`,
+		callID, ts)
+	return err
+}
+
+// FinishCall records the end of a call: a call still ringing becomes missed, a
+// rejected call stays rejected, and an answered call gets its duration. The
+// timeline row's content is updated to match. Returns the final call and its chat ID, or sql.ErrNoRows
+// if the call's offer was never recorded.
+func (s *Store) FinishCall(ctx context.Context, callID, reason string, ts time.Time) (*Call, string, error) {
+	var call Call
+	var chatID string
+	var duration sql.NullInt64
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE wa_bridge.calls
+		 SET status = CASE WHEN status = 'ringing' THEN 'missed' ELSE status END,
+		     ended_at = $2,
+		     terminate_reason = NULLIF($3, ''),
+		     duration_seconds = CASE WHEN answered_at IS NOT NULL
+		                             THEN GREATEST(0, EXTRACT(EPOCH FROM $2 - answered_at))::integer END
+		 WHERE call_id = $1 AND ended_at IS NULL
+		 RETURNING call_id, chat_id, is_video, status, duration_seconds`,
+		callID, ts, reason).Scan(&call.ID, &chatID, &call.IsVideo, &call.Status, &duration)
+	if err != nil {
+		return nil, "", err
+	}
+	call.DurationSeconds = int(duration.Int64)
+
+	if _, err := s.db.ExecContext(ctx,
+		`UPDATE wa_bridge.messages SET content = $3 WHERE message_id = $1 AND chat_id = $2`,
+		call.ID, chatID, call.Text()); err != nil {
+		log.Error().Err(err).Str("call_id", call.ID).Msg("failed to update call timeline row")
+	}
+	return &call, chatID, nil
+}
+
+// UnmarkCallRejected returns a call saved as rejected to ringing when sending
+// the rejection failed, and updates the timeline row to match.
+func (s *Store) UnmarkCallRejected(ctx context.Context, callID string) error {
+	var call Call
+	var chatID string
+	err := s.db.QueryRowContext(ctx,
+		`UPDATE wa_bridge.calls SET status = 'ringing'
+		 WHERE call_id = $1 AND status = 'rejected' AND ended_at IS NULL
+		 RETURNING call_id, chat_id, is_video, status`,
+		callID).Scan(&call.ID, &chatID, &call.IsVideo, &call.Status)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE wa_bridge.messages SET content = $3 WHERE message_id = $1 AND chat_id = $2`,
+		call.ID, chatID, call.Text())
+	return err
+}
+
+// EnqueueOutgoingMessage inserts a text message into the outbox; the
+// new_outgoing_message trigger hands it to the outbox listener.
+func (s *Store) EnqueueOutgoingMessage(ctx context.Context, chatID, content string) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.outgoing_messages (chat_id, content) VALUES ($1, $2)`,
+		chatID, content)
+	return err
+}
@@ -0,0 +1,23 @@
+package store
+
+import "testing"
+
+func TestCallText(t *testing.T) {
+	tests := []struct {
+		call Call
+		want string
+	}{
+		{Call{Status: "ringing"}, "Incoming voice call"},
+		{Call{Status: "ringing", IsVideo: true}, "Incoming video call"},
+		{Call{Status: "missed"}, "Missed voice call"},
+		{Call{Status: "rejected", IsVideo: true}, "Rejected video call"},
+		{Call{Status: "answered"}, "Answered voice call"},
+		{Call{Status: "answered", IsVideo: true, DurationSeconds: 135}, "Answered video call (2:15)"},
+		{Call{Status: "answered", DurationSeconds: 3605}, "Answered voice call (60:05)"},
+	}
+	for _, tt := range tests {
+		if got := tt.call.Text(); got != tt.want {
+			t.Errorf("%+v.Text() = %q, want %q", tt.call, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// GroupParticipant is a member of a group chat, identified by phone number.
+type GroupParticipant struct {
+	ID           string
+	IsAdmin      bool
+	IsSuperAdmin bool
+}
+
+// UpsertGroupChat creates a group chat row if it does not exist yet and
+// updates its name and topic. An empty name leaves the stored one in place;
+// topic is only written when setTopic is true, so "" can clear it.
+func (s *Store) UpsertGroupChat(ctx context.Context, chatID, name, topic string, setTopic bool) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.chats (chat_id, is_group, name, topic)
+		 VALUES ($1, true, NULLIF($2, ''), CASE WHEN $4 THEN NULLIF($3, '') END)
+		 ON CONFLICT (chat_id) DO UPDATE SET
+		   name = COALESCE(NULLIF($2, ''), wa_bridge.chats.name),
+		   topic = CASE WHEN $4 THEN NULLIF($3, '') ELSE wa_bridge.chats.topic END`,
+		chatID, name, topic, setTopic)
+	return err
+}
+
+// SyncGroupParticipants makes wa_bridge.group_participants match the full
+// member list of a group: listed members are upserted as active with their
+// current admin flags, and active rows missing from the list are marked as
+// having left at ts.
+func (s *Store) SyncGroupParticipants(ctx context.Context, chatID string, participants []GroupParticipant, ts time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	ids := make([]string, 0, len(participants))
+	for _, p := range participants {
+		ids = append(ids, p.ID)
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO wa_bridge.group_participants (chat_id, participant_id, is_admin, is_super_admin, is_active, joined_at, updated_at)
+			 VALUES ($1, $2, $3, $4, true, $5, now())
+			 ON CONFLICT (chat_id, participant_id) DO UPDATE SET
+			   is_admin = EXCLUDED.is_admin,
+			   is_super_admin = EXCLUDED.is_super_admin,
+			   joined_at = CASE WHEN wa_bridge.group_participants.is_active
+			                    THEN wa_bridge.group_participants.joined_at
+			                    ELSE EXCLUDED.joined_at END,
+			   left_at = NULL,
+			   is_active = true,
+			   updated_at = now()`,
+			chatID, p.ID, p.IsAdmin, p.IsSuperAdmin, ts)
+		if err != nil {
+			return fmt.Errorf("upsert participant %s: %w", p.ID, err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE wa_bridge.group_participants
+		 SET is_active = false, is_admin = false, is_super_admin = false, left_at = $3, updated_at = now()
+		 WHERE chat_id = $1 AND is_active AND NOT (participant_id = ANY($2))`,
+		chatID, pq.Array(ids), ts)
+	if err != nil {
+		return fmt.Errorf("mark departed participants: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// ApplyGroupParticipantChange records a membership change for the given
+// participants. change is "join", "leave", "promote" or "demote".
+func (s *Store) ApplyGroupParticipantChange(ctx context.Context, chatID string, participantIDs []string, change string, ts time.Time) error {
+	var query string
+	switch change {
+	case "join":
+		query = `INSERT INTO wa_bridge.group_participants (chat_id, participant_id, is_active, joined_at, updated_at)
+		         SELECT $1, unnest($2::text[]), true, $3, now()
+		         ON CONFLICT (chat_id, participant_id) DO UPDATE SET
+		           is_active = true, joined_at = EXCLUDED.joined_at, left_at = NULL, updated_at = now()`
+	case "leave":
+		query = `UPDATE wa_bridge.group_participants
+		         SET is_active = false, is_admin = false, is_super_admin = false, left_at = $3, updated_at = now()
+		         WHERE chat_id = $1 AND participant_id = ANY($2)`
+	case "promote":
+		query = `INSERT INTO wa_bridge.group_participants (chat_id, participant_id, is_admin, is_active, promoted_at, updated_at)
+		         SELECT $1, unnest($2::text[]), true, true, $3, now()
+		         ON CONFLICT (chat_id, participant_id) DO UPDATE SET
+		           is_admin = true, promoted_at = EXCLUDED.promoted_at, updated_at = now()`
+	case "demote":
+		query = `UPDATE wa_bridge.group_participants
+		         SET is_admin = false, is_super_admin = false, demoted_at = $3, updated_at = now()
+		         WHERE chat_id = $1 AND participant_id = ANY($2)`
+	default:
+		return fmt.Errorf("unknown participant change %q", change)
+	}
+	_, err := s.db.ExecContext(ctx, query, chatID, pq.Array(participantIDs), ts)
+	return err
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"context"
+	"time"
+)
+
+// HistoryConversation is the chat-level state carried by a history sync
+// conversation. Zero times mean "not set".
+type HistoryConversation struct {
+	ChatID         string
+	IsGroup        bool
+	Name           string
+	LastMessageAt  time.Time
+	IsArchived     bool
+	PinnedAt       time.Time
+	MutedUntil     time.Time
+	UnreadCount    int
+	IsMarkedUnread bool
+}
+
+// SaveHistoryConversation upserts a chat with the archive, pin, mute and
+// unread state from a history sync. last_message_at only moves forward.
+func (s *Store) SaveHistoryConversation(ctx context.Context, conv HistoryConversation) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.chats (chat_id, is_group, name, last_message_at,
+		                              is_archived, pinned_at, muted_until, unread_count, is_marked_unread)
+		 VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, $9)
+		 ON CONFLICT (chat_id) DO UPDATE SET
+		   name = COALESCE(NULLIF($3, ''), wa_bridge.chats.name),
+		   last_message_at = GREATEST(wa_bridge.chats.last_message_at, EXCLUDED.last_message_at),
+		   is_archived = EXCLUDED.is_archived,
+		   pinned_at = EXCLUDED.pinned_at,
+		   muted_until = EXCLUDED.muted_until,
+		   unread_count = EXCLUDED.unread_count,
+		   is_marked_unread = EXCLUDED.is_marked_unread`,
+		conv.ChatID, conv.IsGroup, conv.Name, nullTime(conv.LastMessageAt),
+		conv.IsArchived, nullTime(conv.PinnedAt), nullTime(conv.MutedUntil), conv.UnreadCount, conv.IsMarkedUnread)
+	return err
+}
+
+// SavePushName records a contact's push name without touching last_seen_at,
+// since history sync names say nothing about recent activity.
+func (s *Store) SavePushName(ctx context.Context, phone, pushName string) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.contacts (phone_number, push_name)
+		 VALUES ($1, $2)
+		 ON CONFLICT (phone_number) DO UPDATE SET push_name = EXCLUDED.push_name`,
+		phone, pushName)
+	return err
+}
+
+// RecordHistorySyncChunk adds one received chunk to the sync's status row in
+// wa_bridge.history_sync_status. A chunk arriving after the sync was marked
+// complete starts a new run (e.g. after re-linking the device).
+func (s *Store) RecordHistorySyncChunk(ctx context.Context, syncType string, progress, conversations, messages, pushNames int) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.history_sync_status AS s (sync_type, progress, chunks, conversations, messages, push_names,
+		                                            started_at, updated_at, completed_at)
+		 VALUES ($1, $2, 1, $3, $4, $5, now(), now(), CASE WHEN $2 >= 100 THEN now() END)
+		 ON CONFLICT (sync_type) DO UPDATE SET
+		   progress = GREATEST(CASE WHEN s.completed_at IS NULL THEN s.progress ELSE 0 END, EXCLUDED.progress),
+		   chunks = CASE WHEN s.completed_at IS NULL THEN s.chunks ELSE 0 END + 1,
+		   conversations = CASE WHEN s.completed_at IS NULL THEN s.conversations ELSE 0 END + EXCLUDED.conversations,
+		   messages = CASE WHEN s.completed_at IS NULL THEN s.messages ELSE 0 END + EXCLUDED.messages,
+		   push_names = CASE WHEN s.completed_at IS NULL THEN s.push_names ELSE 0 END + EXCLUDED.push_names,
+		   started_at = CASE WHEN s.completed_at IS NULL THEN s.started_at ELSE now() END,
+		   updated_at = now(),
+		   completed_at = CASE WHEN EXCLUDED.progress >= 100 THEN now() END`,
+		syncType, progress, conversations, messages, pushNames)
+	return err
+}
+
+// nullTime maps the zero time to NULL.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// MessageAnchor identifies a stored message to page history from.
+type MessageAnchor struct {
+	MessageID string
+	IsFromMe  bool
+	Timestamp time.Time
+}
+
+// OldestMessage returns the oldest stored message in a chat. Returns
+// sql.ErrNoRows if the chat has no messages.
+func (s *Store) OldestMessage(ctx context.Context, chatID string) (*MessageAnchor, error) {
+	var a MessageAnchor
+	err := s.db.QueryRowContext(ctx,
+		`SELECT message_id, is_from_me, timestamp
+		 FROM wa_bridge.messages
+		 WHERE chat_id = $1
+		 ORDER BY timestamp ASC, message_id ASC
+		 LIMIT 1`,
+		chatID).Scan(&a.MessageID, &a.IsFromMe, &a.Timestamp)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"encoding/json"
+)
+
+// Selection is the choice a customer made by tapping a button or list row.
+// Type is "button", "list", "template_button" or "native_flow".
+type Selection struct {
+	Type   string          `json:"type"`
+	ID     string          `json:"id"`
+	Title  string          `json:"title,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// NativeFlowSelection builds the Selection for a native flow response. The
+// selected ID lives in the flow's JSON parameters; unparseable parameters are
+// kept out of the selection and only the title is recorded.
+func NativeFlowSelection(title, paramsJSON string) *Selection {
+	sel := &Selection{Type: "native_flow", Title: title}
+	var params struct {
+		ID string `json:"id"`
+	}
+	if paramsJSON != "" && json.Unmarshal([]byte(paramsJSON), &params) == nil {
+		sel.ID = params.ID
+		sel.Params = json.RawMessage(paramsJSON)
+	}
+	return sel
+}
+
+// Interactive describes a button or list message sent from the outbox. Type
+// is "buttons" (up to three reply buttons) or "list" (a menu of rows grouped
+// in sections, opened with ButtonText).
+type Interactive struct {
+	Type       string               `json:"type"`
+	Buttons    []InteractiveButton  `json:"buttons,omitempty"`
+	ButtonText string               `json:"button_text,omitempty"`
+	Sections   []InteractiveSection `json:"sections,omitempty"`
+	Footer     string               `json:"footer,omitempty"`
+}
+
+// InteractiveButton is a reply button of a buttons message.
+type InteractiveButton struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// InteractiveSection is a titled group of rows in a list message.
+type InteractiveSection struct {
+	Title string           `json:"title,omitempty"`
+	Rows  []InteractiveRow `json:"rows"`
+}
+
+// InteractiveRow is a selectable row of a list message.
+type InteractiveRow struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
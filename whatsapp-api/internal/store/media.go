@@ -0,0 +1,214 @@
+package store
+
+import (
+	"context"
+	"fmt"
+)
+
+// MediaKeys is the key material needed to download a WhatsApp attachment
+// again after the original message event is gone. It is kept in
+// wa_bridge.media_keys, which is not exposed outside the bridge.
+type MediaKeys struct {
+	DirectPath    string
+	MediaKey      []byte
+	FileSHA256    []byte
+	FileEncSHA256 []byte
+	FileLength    int64
+	MimeType      string
+	// Thumbnail is the small JPEG preview embedded in the message, if any.
+	Thumbnail []byte
+}
+
+// MediaMeta is the file metadata WhatsApp sends with an attachment. Zero
+// values are stored as NULL.
+type MediaMeta struct {
+	MimeType        string `json:"mime_type,omitempty"`
+	FileName        string `json:"file_name,omitempty"`
+	Size            int64  `json:"size,omitempty"`
+	SHA256          string `json:"sha256,omitempty"` // hex
+	Width           int    `json:"width,omitempty"`
+	Height          int    `json:"height,omitempty"`
+	DurationSeconds int    `json:"duration_seconds,omitempty"`
+	PageCount       int    `json:"page_count,omitempty"`
+}
+
+// mediaColumns returns the media metadata column values for SaveMessage, all
+// NULL when meta is nil.
+func mediaColumns(meta *MediaMeta) []interface{} {
+	if meta == nil {
+		return []interface{}{nil, nil, nil, nil, nil, nil, nil, nil}
+	}
+	str := func(v string) interface{} {
+		if v == "" {
+			return nil
+		}
+		return v
+	}
+	num := func(v int64) interface{} {
+		if v == 0 {
+			return nil
+		}
+		return v
+	}
+	return []interface{}{
+		str(meta.MimeType), str(meta.FileName), num(meta.Size), str(meta.SHA256),
+		num(int64(meta.Width)), num(int64(meta.Height)), num(int64(meta.DurationSeconds)), num(int64(meta.PageCount)),
+	}
+}
+
+// MediaTarget is a stored media message with everything needed to download
+// its attachment and, if the CDN copy has expired, to ask the sender's phone
+// to re-upload it.
+type MediaTarget struct {
+	ChatID    string
+	MessageID string
+	MediaType string
+	SenderJID string
+	IsFromMe  bool
+	IsGroup   bool
+	FileName  string
+	Keys      MediaKeys
+}
+
+// MediaTarget returns the download target of a media message. ok is false
+// when the payload carries no key material.
+func (p *MessagePayload) MediaTarget() (t MediaTarget, ok bool) {
+	if p.MediaKeys == nil {
+		return MediaTarget{}, false
+	}
+	t = MediaTarget{
+		ChatID:    p.ChatID,
+		MessageID: p.MessageID,
+		MediaType: p.MediaType,
+		SenderJID: p.SenderJID,
+		IsFromMe:  p.IsFromMe,
+		IsGroup:   p.IsGroup,
+		Keys:      *p.MediaKeys,
+	}
+	if p.Media != nil {
+		t.FileName = p.Media.FileName
+	}
+	return t, true
+}
+
+// Media download states recorded in wa_bridge.messages.media_status.
+const (
+	MediaPending        = "pending"
+	MediaStored         = "stored"
+	MediaDownloadFailed = "download_failed"
+	MediaUploadFailed   = "upload_failed"
+	// MediaUnavailable means neither the CDN nor the sender's phone has the
+	// file any more; the sweep stops retrying.
+	MediaUnavailable = "unavailable"
+	// MediaSkippedTooLarge means the attachment exceeds the configured size
+	// limit and was not downloaded.
+	MediaSkippedTooLarge = "skipped_too_large"
+)
+
+// SaveMediaKeys stores or replaces the key material of a media message.
+func (s *Store) SaveMediaKeys(ctx context.Context, chatID, messageID string, keys MediaKeys) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.media_keys (message_id, chat_id, direct_path, media_key, file_sha256, file_enc_sha256, file_length, mime_type, jpeg_thumbnail)
+		 VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, NULLIF($8, ''), $9)
+		 ON CONFLICT (message_id, chat_id) DO UPDATE SET
+		   direct_path = EXCLUDED.direct_path,
+		   media_key = EXCLUDED.media_key,
+		   file_sha256 = EXCLUDED.file_sha256,
+		   file_enc_sha256 = EXCLUDED.file_enc_sha256,
+		   file_length = EXCLUDED.file_length,
+		   mime_type = EXCLUDED.mime_type,
+		   jpeg_thumbnail = COALESCE(EXCLUDED.jpeg_thumbnail, wa_bridge.media_keys.jpeg_thumbnail)`,
+		messageID, chatID, keys.DirectPath, keys.MediaKey, keys.FileSHA256, keys.FileEncSHA256, keys.FileLength, keys.MimeType, keys.Thumbnail)
+	return err
+}
+
+// UpdateMediaDirectPath records the new CDN path the phone reported after a
+// media retry, so later attempts start from it.
+func (s *Store) UpdateMediaDirectPath(ctx context.Context, chatID, messageID, directPath string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE wa_bridge.media_keys SET direct_path = $3 WHERE chat_id = $1 AND message_id = $2`,
+		chatID, messageID, directPath)
+	return err
+}
+
+// SetThumbnailPath records where a message's attachment preview is stored.
+func (s *Store) SetThumbnailPath(ctx context.Context, chatID, messageID, path string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE wa_bridge.messages SET thumbnail_path = $3 WHERE chat_id = $1 AND message_id = $2`,
+		chatID, messageID, path)
+	return err
+}
+
+// MarkMediaFailed records a failed download or upload attempt on the message.
+// status is one of MediaDownloadFailed, MediaUploadFailed, MediaUnavailable
+// or MediaSkippedTooLarge.
+func (s *Store) MarkMediaFailed(ctx context.Context, chatID, messageID, status, errMsg string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE wa_bridge.messages
+		 SET media_status = $3, media_error = $4,
+		     media_attempts = media_attempts + 1, media_last_attempt_at = now()
+		 WHERE chat_id = $1 AND message_id = $2`,
+		chatID, messageID, status, errMsg)
+	return err
+}
+
+const mediaTargetColumns = `m.chat_id, m.message_id, COALESCE(m.media_type, ''), COALESCE(m.sender_jid, ''), m.is_from_me, c.is_group, COALESCE(m.media_filename, ''),
+	        COALESCE(k.direct_path, ''), k.media_key, k.file_sha256, k.file_enc_sha256, COALESCE(k.file_length, 0), COALESCE(k.mime_type, ''), k.jpeg_thumbnail
+	 FROM wa_bridge.messages m
+	 JOIN wa_bridge.media_keys k ON k.message_id = m.message_id AND k.chat_id = m.chat_id
+	 JOIN wa_bridge.chats c ON c.chat_id = m.chat_id`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMediaTarget(row rowScanner) (MediaTarget, error) {
+	var t MediaTarget
+	err := row.Scan(&t.ChatID, &t.MessageID, &t.MediaType, &t.SenderJID, &t.IsFromMe, &t.IsGroup, &t.FileName,
+		&t.Keys.DirectPath, &t.Keys.MediaKey, &t.Keys.FileSHA256, &t.Keys.FileEncSHA256, &t.Keys.FileLength, &t.Keys.MimeType, &t.Keys.Thumbnail)
+	return t, err
+}
+
+// GetMediaTarget loads a media message together with its key material.
+// Returns sql.ErrNoRows if the message or its keys are not stored.
+func (s *Store) GetMediaTarget(ctx context.Context, chatID, messageID string) (*MediaTarget, error) {
+	t, err := scanMediaTarget(s.db.QueryRowContext(ctx,
+		`SELECT `+mediaTargetColumns+`
+		 WHERE m.chat_id = $1 AND m.message_id = $2`,
+		chatID, messageID))
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// MediaRetryCandidates returns media messages whose attachment should be
+// fetched again: failed attempts below maxAttempts, spaced out by a linear
+// backoff of 15 minutes per attempt, and rows still pending an hour after
+// they were saved (e.g. queued downloads lost to a restart). Newest first.
+func (s *Store) MediaRetryCandidates(ctx context.Context, maxAttempts, limit int) ([]MediaTarget, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+mediaTargetColumns+`
+		 WHERE m.media_path IS NULL
+		   AND ((m.media_status IN ('download_failed', 'upload_failed')
+		         AND m.media_attempts < $1
+		         AND m.media_last_attempt_at < now() - make_interval(mins => 15 * m.media_attempts))
+		     OR (m.media_status = 'pending' AND m.created_at < now() - interval '1 hour'))
+		 ORDER BY m.timestamp DESC
+		 LIMIT $2`,
+		maxAttempts, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying media retry candidates: %w", err)
+	}
+	defer rows.Close()
+
+	var targets []MediaTarget
+	for rows.Next() {
+		t, err := scanMediaTarget(rows)
+		if err != nil {
+			return targets, fmt.Errorf("scanning media retry candidate: %w", err)
+		}
+		targets = append(targets, t)
+	}
+	return targets, rows.Err()
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Poll is a WhatsApp poll created in a chat, either by us or by the customer.
+type Poll struct {
+	Name            string   `json:"name"`
+	Options         []string `json:"options"`
+	SelectableCount int      `json:"selectable_count"`
+
+	// QuoteOptionIDs holds, per option, the public.quote_options ID a vote
+	// for that option selects, or "" for options that are not linked. Empty
+	// for polls without quote links.
+	QuoteOptionIDs []string `json:"-"`
+}
+
+// SavePoll records the options of a poll creation message so later votes,
+// which only carry option hashes, can be resolved to option names.
+func (s *Store) SavePoll(ctx context.Context, messageID, chatID string, poll *Poll) error {
+	var quoteOptionIDs interface{}
+	if len(poll.QuoteOptionIDs) > 0 {
+		quoteOptionIDs = pq.Array(poll.QuoteOptionIDs)
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.polls (message_id, chat_id, name, options, selectable_count, quote_option_ids)
+		 VALUES ($1, $2, $3, $4, $5, $6)
+		 ON CONFLICT (message_id, chat_id) DO NOTHING`,
+		messageID, chatID, poll.Name, pq.Array(poll.Options), poll.SelectableCount, quoteOptionIDs)
+	return err
+}
+
+// GetPoll looks up a stored poll. Returns sql.ErrNoRows if the poll creation
+// message was never seen by the bridge.
+func (s *Store) GetPoll(ctx context.Context, chatID, messageID string) (*Poll, error) {
+	var p Poll
+	var quoteOptionIDs []sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		`SELECT name, options, selectable_count, COALESCE(quote_option_ids::text[], '{}')
+		 FROM wa_bridge.polls
+		 WHERE chat_id = $1 AND message_id = $2`,
+		chatID, messageID).Scan(&p.Name, pq.Array(&p.Options), &p.SelectableCount, pq.Array(&quoteOptionIDs))
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range quoteOptionIDs {
+		p.QuoteOptionIDs = append(p.QuoteOptionIDs, id.String)
+	}
+	return &p, nil
+}
+
+// InsertSentPollMessage inserts a just-sent poll into the messages table, with
+// the question as its content, and records its options.
+func (s *Store) InsertSentPollMessage(ctx context.Context, messageID, chatID, senderID string, poll *Poll, replyToMessageID string, ts time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.messages (message_id, chat_id, sender_id, sender_name, message_type, content, is_from_me, reply_to_message_id, timestamp, delivery_status)
+		 VALUES ($1, $2, $3, '', 'poll', $4, true, NULLIF($5, ''), $6, 'sent')
+		 ON CONFLICT (message_id, chat_id) DO NOTHING`,
+		messageID, chatID, senderID, poll.Name, replyToMessageID, ts)
+	if err != nil {
+		return err
+	}
+	return s.SavePoll(ctx, messageID, chatID, poll)
+}
+
+// UpsertPollVote records a voter's current selection on a poll. WhatsApp
+// sends the full selection with every vote, so the row is replaced; an empty
+// selection means the voter withdrew their vote.
+func (s *Store) UpsertPollVote(ctx context.Context, pollMessageID, chatID, voterID, voterName string, selected []string, ts time.Time) error {
+	if voterID != "" {
+		_, err := s.db.ExecContext(ctx,
+			`INSERT INTO wa_bridge.contacts (phone_number, push_name, last_seen_at)
+			 VALUES ($1, $2, now())
+			 ON CONFLICT (phone_number) DO UPDATE SET
+			   push_name = COALESCE(NULLIF($2, ''), wa_bridge.contacts.push_name),
+			   last_seen_at = now()`,
+			voterID, voterName)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to upsert contact for poll vote")
+		}
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.poll_votes (poll_message_id, chat_id, voter_id, selected_options, timestamp)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (poll_message_id, chat_id, voter_id) DO UPDATE SET
+		   selected_options = EXCLUDED.selected_options, timestamp = EXCLUDED.timestamp`,
+		pollMessageID, chatID, voterID, pq.Array(selected), ts)
+	return err
+}
+
+// SelectQuoteOption marks a quote option as the customer's choice and clears
+// the selection on the other options of the same flight request.
+func (s *Store) SelectQuoteOption(ctx context.Context, quoteOptionID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE public.quote_options
+		 SET is_selected = (id = $1)
+		 WHERE flight_request_id = (SELECT flight_request_id FROM public.quote_options WHERE id = $1)`,
+		quoteOptionID)
+	return err
+}
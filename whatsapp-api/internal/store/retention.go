@@ -0,0 +1,187 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// MediaExpired marks media removed by the retention policy.
+const MediaExpired = "expired"
+
+// RetentionCandidate is a stored attachment old enough to expire. SHA256 is
+// empty for media stored before deduplication.
+type RetentionCandidate struct {
+	ChatID    string
+	MessageID string
+	MediaPath string
+	SHA256    string
+}
+
+// HasDocumentsTable reports whether public.documents (the wa-sales document
+// tags) exists and the bridge can read it: SELECT on the columns retention
+// checks and, when row level security is on, a SELECT policy for this role.
+// Without the policy the table would read as empty and protect nothing.
+func (s *Store) HasDocumentsTable(ctx context.Context) (bool, error) {
+	var readable bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COALESCE(
+		        has_column_privilege(t.oid, 'message_id', 'SELECT')
+		    AND has_column_privilege(t.oid, 'chat_id', 'SELECT')
+		    AND has_column_privilege(t.oid, 'storage_path', 'SELECT')
+		    AND (NOT c.relrowsecurity
+		         OR r.rolsuper OR r.rolbypassrls
+		         OR EXISTS (SELECT 1 FROM pg_policies p, unnest(p.roles) AS role
+		                     WHERE p.schemaname = 'public' AND p.tablename = 'documents'
+		                       AND p.cmd IN ('SELECT', 'ALL')
+		                       AND CASE WHEN role = 'public' THEN true
+		                                ELSE pg_has_role(current_user, role, 'MEMBER') END)),
+		    false)
+		 FROM (SELECT to_regclass('public.documents') AS oid) t
+		 LEFT JOIN pg_class c ON c.oid = t.oid
+		 LEFT JOIN pg_roles r ON r.rolname = current_user`).Scan(&readable)
+	return readable, err
+}
+
+// RetentionCandidates returns up to limit stored attachments of mediaType in
+// customer or group chats whose message is older than before, oldest first.
+// When checkDocuments is set, media tagged in public.documents (by message or
+// storage path) is never returned.
+func (s *Store) RetentionCandidates(ctx context.Context, mediaType string, isGroup bool, before time.Time, checkDocuments bool, limit int) ([]RetentionCandidate, error) {
+	query := `SELECT m.chat_id, m.message_id, m.media_path, COALESCE(mm.sha256, '')
+		 FROM wa_bridge.messages m
+		 JOIN wa_bridge.chats c ON c.chat_id = m.chat_id
+		 LEFT JOIN wa_bridge.message_media mm ON mm.message_id = m.message_id AND mm.chat_id = m.chat_id
+		 WHERE m.media_status = 'stored' AND m.media_path IS NOT NULL
+		   AND m.media_type = $1 AND c.is_group = $2 AND m.timestamp < $3`
+	if checkDocuments {
+		query += `
+		   AND NOT EXISTS (
+		       SELECT 1 FROM public.documents d
+		       WHERE (d.message_id = m.message_id AND d.chat_id = m.chat_id)
+		          OR d.storage_path = m.media_path)`
+	}
+	query += `
+		 ORDER BY m.timestamp
+		 LIMIT $4`
+
+	rows, err := s.db.QueryContext(ctx, query, mediaType, isGroup, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []RetentionCandidate
+	for rows.Next() {
+		var c RetentionCandidate
+		if err := rows.Scan(&c.ChatID, &c.MessageID, &c.MediaPath, &c.SHA256); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates, rows.Err()
+}
+
+// MediaPathShared reports whether another message with stored media points
+// at the same media_path, e.g. outgoing messages that reused one upload.
+func (s *Store) MediaPathShared(ctx context.Context, chatID, messageID, mediaPath string) (bool, error) {
+	var shared bool
+	err := s.db.QueryRowContext(ctx,
+		`SELECT EXISTS (
+		     SELECT 1 FROM wa_bridge.messages
+		     WHERE media_path = $3 AND media_status = 'stored'
+		       AND NOT (chat_id = $1 AND message_id = $2))`,
+		chatID, messageID, mediaPath).Scan(&shared)
+	return shared, err
+}
+
+// ReleaseMediaBlob removes a blob once no message other than the given one
+// still has it stored. It marks the blob released (which keeps it from being
+// reused or linked), calls remove to delete or archive the file outside the
+// transaction, so a slow storage backend holds no lock, and then drops the
+// blob and its message links so later copies of the same content are
+// uploaded again. If remove fails the mark is cleared again; a mark left by a
+// crash is finished by the next sweep, which finds the message still stored.
+// Returns false, leaving everything in place, while other messages still use
+// the blob.
+func (s *Store) ReleaseMediaBlob(ctx context.Context, sha256, chatID, messageID string, remove func(MediaBlob) error) (bool, error) {
+	b, ok, err := s.markBlobReleased(ctx, sha256, chatID, messageID)
+	if err != nil || !ok || b.Path == "" {
+		return ok, err
+	}
+
+	if err := remove(b); err != nil {
+		if _, rerr := s.db.ExecContext(ctx,
+			`UPDATE wa_bridge.media_blobs SET released_at = NULL WHERE sha256 = $1`, sha256); rerr != nil {
+			log.Error().Err(rerr).Str("sha256", sha256).Msg("failed to clear blob release mark")
+		}
+		return false, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx, `DELETE FROM wa_bridge.message_media WHERE sha256 = $1`, sha256); err != nil {
+		return false, fmt.Errorf("delete blob links: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM wa_bridge.media_blobs WHERE sha256 = $1`, sha256); err != nil {
+		return false, fmt.Errorf("delete blob: %w", err)
+	}
+	return true, tx.Commit()
+}
+
+// markBlobReleased sets released_at on a blob no stored message other than
+// the given one uses. ok is false while it is still in use; a blob that no
+// longer exists is returned with an empty path and ok set.
+func (s *Store) markBlobReleased(ctx context.Context, sha256, chatID, messageID string) (MediaBlob, bool, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return MediaBlob{}, false, fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	b := MediaBlob{SHA256: sha256}
+	err = tx.QueryRowContext(ctx,
+		`SELECT bucket, path FROM wa_bridge.media_blobs WHERE sha256 = $1 FOR UPDATE`,
+		sha256).Scan(&b.Bucket, &b.Path)
+	if err == sql.ErrNoRows {
+		return MediaBlob{}, true, nil
+	} else if err != nil {
+		return MediaBlob{}, false, fmt.Errorf("lock blob: %w", err)
+	}
+
+	var inUse bool
+	if err := tx.QueryRowContext(ctx,
+		`SELECT EXISTS (
+		     SELECT 1 FROM wa_bridge.message_media mm
+		     JOIN wa_bridge.messages m ON m.message_id = mm.message_id AND m.chat_id = mm.chat_id
+		     WHERE mm.sha256 = $1 AND m.media_status = 'stored'
+		       AND NOT (m.chat_id = $2 AND m.message_id = $3))`,
+		sha256, chatID, messageID).Scan(&inUse); err != nil {
+		return MediaBlob{}, false, fmt.Errorf("check blob references: %w", err)
+	}
+	if inUse {
+		return MediaBlob{}, false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE wa_bridge.media_blobs SET released_at = now() WHERE sha256 = $1`, sha256); err != nil {
+		return MediaBlob{}, false, fmt.Errorf("mark blob released: %w", err)
+	}
+	return b, true, tx.Commit()
+}
+
+// ExpireMessageMedia marks a message's stored attachment as removed by the
+// retention policy. media_path is kept as a record of where the file was (or,
+// when archived, where it is in the archive bucket).
+func (s *Store) ExpireMessageMedia(ctx context.Context, chatID, messageID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE wa_bridge.messages
+		 SET media_status = 'expired', media_expired_at = now()
+		 WHERE chat_id = $1 AND message_id = $2 AND media_status = 'stored'`,
+		chatID, messageID)
+	return err
+}
@@ -8,7 +8,7 @@ import (
 	"fmt"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"whatsapp-bridge/internal/logging"
 )
@@ -47,18 +47,77 @@ func (s *Store) DB() *sql.DB {
 // MessagePayload is the canonical representation of a WhatsApp message used
 // across the store, messaging, and webhook packages.
 type MessagePayload struct {
-	Timestamp        time.Time `json:"timestamp"`
-	MessageID        string    `json:"message_id"`
-	ChatID           string    `json:"chat_id"`
-	ChatName         string    `json:"chat_name,omitempty"`
-	SenderID         string    `json:"sender_id"`
-	SenderName       string    `json:"sender_name,omitempty"`
-	MessageType      string    `json:"message_type"`
-	Text             string    `json:"text,omitempty"`
-	MediaType        string    `json:"media_type,omitempty"`
-	ReplyToMessageID string    `json:"reply_to_message_id,omitempty"`
-	IsGroup          bool      `json:"is_group"`
-	IsFromMe         bool      `json:"is_from_me"`
+	Timestamp time.Time `json:"timestamp"`
+	MessageID string    `json:"message_id"`
+	ChatID    string    `json:"chat_id"`
+	ChatName  string    `json:"chat_name,omitempty"`
+	SenderID  string    `json:"sender_id"`
+	// SenderJID is the author's full JID (phone number or LID) as WhatsApp
+	// addresses them; in groups SenderID holds the group instead. Used to
+	// quote, react to and request re-uploads of the message.
+	SenderJID        string     `json:"sender_jid,omitempty"`
+	SenderName       string     `json:"sender_name,omitempty"`
+	MessageType      string     `json:"message_type"`
+	Text             string     `json:"text,omitempty"`
+	MediaType        string     `json:"media_type,omitempty"`
+	ReplyToMessageID string     `json:"reply_to_message_id,omitempty"`
+	IsGroup          bool       `json:"is_group"`
+	IsFromMe         bool       `json:"is_from_me"`
+	Location         *Location  `json:"location,omitempty"`
+	Poll             *Poll      `json:"poll,omitempty"`
+	IsViewOnce       bool       `json:"is_view_once,omitempty"`
+	IsEphemeral      bool       `json:"is_ephemeral,omitempty"`
+	Selection        *Selection `json:"selection,omitempty"`
+	Call             *Call      `json:"call,omitempty"`
+	// MediaKeys is stored in wa_bridge.media_keys so the attachment can be
+	// downloaded again later. Never sent to webhooks.
+	MediaKeys *MediaKeys `json:"-"`
+	Media     *MediaMeta `json:"media,omitempty"`
+}
+
+// Location is a shared or live location attached to a message.
+type Location struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	IsLive    bool    `json:"is_live"`
+}
+
+// Text renders the location as readable message content: the place name and
+// address when present, followed by the coordinates.
+func (l *Location) Text() string {
+	coords := fmt.Sprintf("(%.6f, %.6f)", l.Latitude, l.Longitude)
+	var label string
+	switch {
+	case l.Name != "" && l.Address != "":
+		label = l.Name + ", " + l.Address
+	case l.Name != "":
+		label = l.Name
+	default:
+		label = l.Address
+	}
+	if label == "" {
+		return coords
+	}
+	return label + " " + coords
+}
+
+// locationColumns returns the latitude, longitude, location_name,
+// location_address and is_live_location values for loc, all NULL (and false)
+// when loc is nil.
+func locationColumns(loc *Location) (lat, long *float64, name, address *string, isLive bool) {
+	if loc == nil {
+		return nil, nil, nil, nil, false
+	}
+	lat, long = &loc.Latitude, &loc.Longitude
+	if loc.Name != "" {
+		name = &loc.Name
+	}
+	if loc.Address != "" {
+		address = &loc.Address
+	}
+	return lat, long, name, address, loc.IsLive
 }
 
 // SaveMessage persists a received message along with its contact and chat records.
@@ -96,7 +155,7 @@ func (s *Store) SaveMessage(payload MessagePayload) {
 		 VALUES ($1, $2, NULLIF($3, ''), $4, $5)
 		 ON CONFLICT (chat_id) DO UPDATE SET
 		   name = COALESCE(NULLIF($3, ''), wa_bridge.chats.name),
-		   last_message_at = $4,
+		   last_message_at = GREATEST(wa_bridge.chats.last_message_at, $4),
 		   contact_phone_number = COALESCE($5, wa_bridge.chats.contact_phone_number)`,
 		payload.ChatID, payload.IsGroup, payload.ChatName, payload.Timestamp, contactPhone)
 	if err != nil {
@@ -109,18 +168,48 @@ func (s *Store) SaveMessage(payload MessagePayload) {
 		senderID = &payload.SenderID
 	}
 
+	lat, long, locName, locAddress, isLive := locationColumns(payload.Location)
+
+	var selection []byte
+	if payload.Selection != nil {
+		selection, _ = json.Marshal(payload.Selection)
+	}
+
 	_, err = s.db.ExecContext(ctx,
-		`INSERT INTO wa_bridge.messages (message_id, chat_id, sender_id, sender_name, message_type, media_type, content, is_from_me, reply_to_message_id, timestamp)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10)
+		`INSERT INTO wa_bridge.messages (message_id, chat_id, sender_id, sender_name, message_type, media_type, content, is_from_me, reply_to_message_id, timestamp, delivery_status,
+		                                 sender_jid, latitude, longitude, location_name, location_address, is_live_location,
+		                                 is_view_once, is_ephemeral, selection, media_status,
+		                                 media_mime_type, media_filename, media_size, media_sha256,
+		                                 media_width, media_height, media_duration_seconds, media_page_count)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, CASE WHEN $8 THEN 'sent' END,
+		         NULLIF($11, ''), $12, $13, $14, $15, $16,
+		         $17, $18, $19, CASE WHEN $5 = 'media' THEN 'pending' END,
+		         $20, $21, $22, $23, $24, $25, $26, $27)
 		 ON CONFLICT (message_id, chat_id) DO NOTHING`,
-		payload.MessageID, payload.ChatID, senderID, payload.SenderName,
-		payload.MessageType, payload.MediaType, payload.Text, payload.IsFromMe,
-		payload.ReplyToMessageID, payload.Timestamp)
+		append([]interface{}{
+			payload.MessageID, payload.ChatID, senderID, payload.SenderName,
+			payload.MessageType, payload.MediaType, payload.Text, payload.IsFromMe,
+			payload.ReplyToMessageID, payload.Timestamp,
+			payload.SenderJID, lat, long, locName, locAddress, isLive,
+			payload.IsViewOnce, payload.IsEphemeral, selection,
+		}, mediaColumns(payload.Media)...)...)
 	if err != nil {
 		log.Error().Err(err).Str("message_id", payload.MessageID).Msg("failed to insert message")
 		return
 	}
 
+	if payload.MediaKeys != nil {
+		if err := s.SaveMediaKeys(ctx, payload.ChatID, payload.MessageID, *payload.MediaKeys); err != nil {
+			log.Error().Err(err).Str("message_id", payload.MessageID).Msg("failed to save media keys")
+		}
+	}
+
+	if payload.Poll != nil {
+		if err := s.SavePoll(ctx, payload.MessageID, payload.ChatID, payload.Poll); err != nil {
+			log.Error().Err(err).Str("message_id", payload.MessageID).Msg("failed to save poll")
+		}
+	}
+
 	log.Debug().
 		Str("message_id", payload.MessageID).
 		Str("sender_id", payload.SenderID).
@@ -135,19 +224,72 @@ func (s *Store) UpdateDescription(messageID, chatID, description string) error {
 	return err
 }
 
-// UpdateMediaPath sets the media_path column on a previously saved message.
-func (s *Store) UpdateMediaPath(messageID, chatID, mediaPath string) error {
-	_, err := s.db.ExecContext(context.Background(),
-		`UPDATE wa_bridge.messages SET media_path = $1 WHERE message_id = $2 AND chat_id = $3`,
-		mediaPath, messageID, chatID)
-	return err
+// MediaPath returns the stored media_path of a message, or "" when the media
+// has not been stored yet or has expired.
+func (s *Store) MediaPath(ctx context.Context, chatID, messageID string) (string, error) {
+	var path sql.NullString
+	err := s.db.QueryRowContext(ctx,
+		`SELECT CASE WHEN media_status = 'expired' THEN NULL ELSE media_path END
+		 FROM wa_bridge.messages WHERE chat_id = $1 AND message_id = $2`,
+		chatID, messageID).Scan(&path)
+	return path.String, err
 }
 
-// PendingOutboxIDs returns the IDs of all pending outgoing messages, ordered
-// by insertion order so older messages are processed first.
+// MediaFileName returns the original file name of the newest message whose
+// media is stored at mediaPath, or "" when none has one.
+func (s *Store) MediaFileName(ctx context.Context, mediaPath string) (string, error) {
+	var name string
+	err := s.db.QueryRowContext(ctx,
+		`SELECT media_filename FROM wa_bridge.messages
+		 WHERE media_path = $1 AND media_filename <> ''
+		 ORDER BY timestamp DESC LIMIT 1`,
+		mediaPath).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return name, err
+}
+
+// OutboxMessage represents a claimed row from wa_bridge.outgoing_messages.
+type OutboxMessage struct {
+	ID       int64
+	ChatID   string
+	Content  string
+	Attempts int
+
+	// ReplyToMessageID is the message_id of a message in the same chat that
+	// this message quotes, or "" for a plain message.
+	ReplyToMessageID string
+
+	// Media attachment stored in Supabase Storage. MediaPath is empty for
+	// plain text messages; Content is then used as the caption.
+	MediaPath     string
+	MediaBucket   string
+	MediaType     string
+	MediaMimeType string
+	MediaFilename string
+
+	// Location is set for rows that send a location pin instead of text or
+	// media.
+	Location *Location
+
+	// Poll is set for rows that send a poll; Content is then the question.
+	Poll *Poll
+
+	// Interactive is the raw JSON description (see Interactive) of a button
+	// or list message, or nil. Content is then the body text.
+	Interactive json.RawMessage
+}
+
+// PendingOutboxIDs returns the IDs of all pending outgoing messages that are
+// due, ordered by insertion order so older messages are processed first. Rows
+// scheduled for later (send_at) or waiting for a retry (next_attempt_at) are
+// skipped until that time.
 func (s *Store) PendingOutboxIDs(ctx context.Context) ([]int64, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id FROM wa_bridge.outgoing_messages WHERE status = 'pending' ORDER BY id`)
+		`SELECT id FROM wa_bridge.outgoing_messages
+		 WHERE status = 'pending' AND COALESCE(next_attempt_at, send_at, '-infinity') <= now()
+		 ORDER BY id`)
 	if err != nil {
 		return nil, fmt.Errorf("querying pending outbox: %w", err)
 	}
@@ -164,24 +306,67 @@ func (s *Store) PendingOutboxIDs(ctx context.Context) ([]int64, error) {
 	return ids, rows.Err()
 }
 
-// ClaimOutboxMessage atomically transitions a pending message to 'sending' and
-// returns its chat_id and content. Returns sql.ErrNoRows if the message was
-// already claimed or is no longer pending.
-func (s *Store) ClaimOutboxMessage(ctx context.Context, id int64) (chatID, content string, err error) {
-	err = s.db.QueryRowContext(ctx,
+// NextOutboxDueAt returns the earliest time a pending outgoing message becomes
+// due, considering both retries (next_attempt_at) and scheduled sends
+// (send_at). The returned NullTime is invalid when nothing is waiting.
+func (s *Store) NextOutboxDueAt(ctx context.Context) (sql.NullTime, error) {
+	var next sql.NullTime
+	err := s.db.QueryRowContext(ctx,
+		`SELECT MIN(COALESCE(next_attempt_at, send_at)) FROM wa_bridge.outgoing_messages
+		 WHERE status = 'pending'`).Scan(&next)
+	return next, err
+}
+
+// ClaimOutboxMessage atomically transitions a due pending message to 'sending',
+// increments its attempt counter, and returns its fields. Returns
+// sql.ErrNoRows if the message was already claimed, is no longer pending
+// (e.g. cancelled), or is not yet due.
+func (s *Store) ClaimOutboxMessage(ctx context.Context, id int64) (*OutboxMessage, error) {
+	var msg OutboxMessage
+	var lat, long sql.NullFloat64
+	var locName, locAddress string
+	var pollOptions []string
+	var pollSelectable int
+	var pollQuoteIDs []sql.NullString
+	err := s.db.QueryRowContext(ctx,
 		`UPDATE wa_bridge.outgoing_messages
-		 SET status = 'sending'
+		 SET status = 'sending', attempts = attempts + 1, last_attempt_at = now()
 		 WHERE id = $1 AND status = 'pending'
-		 RETURNING chat_id, content`,
-		id).Scan(&chatID, &content)
-	return chatID, content, err
+		   AND COALESCE(next_attempt_at, send_at, '-infinity') <= now()
+		 RETURNING id, chat_id, COALESCE(content, ''), attempts,
+		           COALESCE(reply_to_message_id, ''),
+		           COALESCE(media_path, ''), media_bucket, COALESCE(media_type, ''),
+		           COALESCE(media_mime_type, ''), COALESCE(media_filename, ''),
+		           latitude, longitude, COALESCE(location_name, ''), COALESCE(location_address, ''),
+		           poll_options, COALESCE(poll_selectable_count, 0), COALESCE(poll_quote_option_ids::text[], '{}'),
+		           interactive`,
+		id).Scan(&msg.ID, &msg.ChatID, &msg.Content, &msg.Attempts,
+		&msg.ReplyToMessageID,
+		&msg.MediaPath, &msg.MediaBucket, &msg.MediaType,
+		&msg.MediaMimeType, &msg.MediaFilename,
+		&lat, &long, &locName, &locAddress,
+		pq.Array(&pollOptions), &pollSelectable, pq.Array(&pollQuoteIDs),
+		&msg.Interactive)
+	if err != nil {
+		return nil, err
+	}
+	if lat.Valid && long.Valid {
+		msg.Location = &Location{Latitude: lat.Float64, Longitude: long.Float64, Name: locName, Address: locAddress}
+	}
+	if len(pollOptions) > 0 {
+		msg.Poll = &Poll{Name: msg.Content, Options: pollOptions, SelectableCount: pollSelectable}
+		for _, id := range pollQuoteIDs {
+			msg.Poll.QuoteOptionIDs = append(msg.Poll.QuoteOptionIDs, id.String)
+		}
+	}
+	return &msg, nil
 }
 
 // MarkOutboxSent records the WhatsApp message ID and timestamp on a sent outbox entry.
 func (s *Store) MarkOutboxSent(ctx context.Context, id int64, sentMessageID string) error {
 	_, err := s.db.ExecContext(ctx,
 		`UPDATE wa_bridge.outgoing_messages
-		 SET status = 'sent', sent_message_id = $1, sent_at = now()
+		 SET status = 'sent', sent_message_id = $1, sent_at = now(), delivery_status = 'sent'
 		 WHERE id = $2`,
 		sentMessageID, id)
 	return err
@@ -201,6 +386,20 @@ func (s *Store) MarkOutboxFailed(ctx context.Context, id int64, errMsg string) {
 	log.Warn().Int64("outbox_id", id).Str("error", errMsg).Msg("outbox message failed")
 }
 
+// MarkOutboxRetry returns an outbox message to 'pending' after a transient
+// send failure, recording the error and the time of the next attempt.
+func (s *Store) MarkOutboxRetry(ctx context.Context, id int64, errMsg string, nextAttemptAt time.Time) {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE wa_bridge.outgoing_messages
+		 SET status = 'pending', error_message = $1, next_attempt_at = $2
+		 WHERE id = $3`,
+		errMsg, nextAttemptAt, id)
+	if err != nil {
+		log.Error().Err(err).Int64("outbox_id", id).Msg("failed to schedule outbox retry")
+	}
+	log.Warn().Int64("outbox_id", id).Str("error", errMsg).Time("next_attempt_at", nextAttemptAt).Msg("outbox message will be retried")
+}
+
 // UpsertOwnContact inserts or updates the bridge account's own contact record
 // so that foreign-key constraints on wa_bridge.messages are satisfied.
 func (s *Store) UpsertOwnContact(ctx context.Context, phoneNumber string) {
@@ -215,16 +414,70 @@ func (s *Store) UpsertOwnContact(ctx context.Context, phoneNumber string) {
 }
 
 // InsertSentMessage inserts a just-sent outgoing message into the messages table
-// so it appears in the conversation history.
-func (s *Store) InsertSentMessage(ctx context.Context, messageID, chatID, senderID, content string, ts time.Time) error {
+// so it appears in the conversation history. replyToMessageID may be empty.
+func (s *Store) InsertSentMessage(ctx context.Context, messageID, chatID, senderID, content, replyToMessageID string, ts time.Time) error {
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO wa_bridge.messages (message_id, chat_id, sender_id, sender_name, message_type, content, is_from_me, timestamp)
-		 VALUES ($1, $2, $3, '', 'text', $4, true, $5)
+		`INSERT INTO wa_bridge.messages (message_id, chat_id, sender_id, sender_name, message_type, content, is_from_me, reply_to_message_id, timestamp, delivery_status)
+		 VALUES ($1, $2, $3, '', 'text', $4, true, NULLIF($5, ''), $6, 'sent')
 		 ON CONFLICT (message_id, chat_id) DO NOTHING`,
-		messageID, chatID, senderID, content, ts)
+		messageID, chatID, senderID, content, replyToMessageID, ts)
 	return err
 }
 
+// InsertSentMediaMessage inserts a just-sent outgoing media message into the
+// messages table with its storage path so it renders in the conversation.
+func (s *Store) InsertSentMediaMessage(ctx context.Context, messageID, chatID, senderID, caption, mediaType, mediaPath, replyToMessageID string, ts time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.messages (message_id, chat_id, sender_id, sender_name, message_type, media_type, content, media_path, is_from_me, reply_to_message_id, timestamp, delivery_status)
+		 VALUES ($1, $2, $3, '', 'media', $4, NULLIF($5, ''), NULLIF($6, ''), true, NULLIF($7, ''), $8, 'sent')
+		 ON CONFLICT (message_id, chat_id) DO NOTHING`,
+		messageID, chatID, senderID, mediaType, caption, mediaPath, replyToMessageID, ts)
+	return err
+}
+
+// InsertSentLocationMessage inserts a just-sent outgoing location into the
+// messages table, with the readable location text as its content.
+func (s *Store) InsertSentLocationMessage(ctx context.Context, messageID, chatID, senderID string, loc *Location, replyToMessageID string, ts time.Time) error {
+	lat, long, locName, locAddress, isLive := locationColumns(loc)
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.messages (message_id, chat_id, sender_id, sender_name, message_type, content, is_from_me, reply_to_message_id, timestamp, delivery_status,
+		                                 latitude, longitude, location_name, location_address, is_live_location)
+		 VALUES ($1, $2, $3, '', 'location', $4, true, NULLIF($5, ''), $6, 'sent',
+		         $7, $8, $9, $10, $11)
+		 ON CONFLICT (message_id, chat_id) DO NOTHING`,
+		messageID, chatID, senderID, loc.Text(), replyToMessageID, ts,
+		lat, long, locName, locAddress, isLive)
+	return err
+}
+
+// StoredMessage holds the fields of a stored message needed to quote, edit or
+// revoke it.
+type StoredMessage struct {
+	MessageID   string
+	SenderID    sql.NullString
+	SenderJID   sql.NullString
+	IsFromMe    bool
+	MessageType string
+	MediaType   sql.NullString
+	Content     sql.NullString
+	IsRevoked   bool
+}
+
+// GetMessage looks up a single message in a chat. Returns sql.ErrNoRows if
+// the message is not stored.
+func (s *Store) GetMessage(ctx context.Context, chatID, messageID string) (*StoredMessage, error) {
+	var q StoredMessage
+	err := s.db.QueryRowContext(ctx,
+		`SELECT message_id, sender_id, sender_jid, is_from_me, message_type, media_type, content, is_revoked
+		 FROM wa_bridge.messages
+		 WHERE chat_id = $1 AND message_id = $2`,
+		chatID, messageID).Scan(&q.MessageID, &q.SenderID, &q.SenderJID, &q.IsFromMe, &q.MessageType, &q.MediaType, &q.Content, &q.IsRevoked)
+	if err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
 // UpdateChatLastMessage bumps the last_message_at timestamp on a chat record.
 func (s *Store) UpdateChatLastMessage(ctx context.Context, chatID string, ts time.Time) error {
 	_, err := s.db.ExecContext(ctx,
@@ -242,6 +495,35 @@ func (s *Store) UpdateChatName(ctx context.Context, chatID, name string) error {
 	return err
 }
 
+// SetChatEphemeralExpiration records a chat's disappearing-messages timer in
+// seconds (0 when disabled). Updates older than the last recorded change are
+// ignored so out-of-order events cannot roll the timer back.
+func (s *Store) SetChatEphemeralExpiration(ctx context.Context, chatID string, isGroup bool, expiration uint32, ts time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO wa_bridge.chats (chat_id, is_group, ephemeral_expiration, ephemeral_setting_at)
+		 VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (chat_id) DO UPDATE SET
+		   ephemeral_expiration = EXCLUDED.ephemeral_expiration,
+		   ephemeral_setting_at = EXCLUDED.ephemeral_setting_at
+		 WHERE wa_bridge.chats.ephemeral_setting_at IS NULL
+		    OR wa_bridge.chats.ephemeral_setting_at <= EXCLUDED.ephemeral_setting_at`,
+		chatID, isGroup, int64(expiration), ts)
+	return err
+}
+
+// ChatEphemeralExpiration returns a chat's disappearing-messages timer in
+// seconds, or 0 if it is disabled or the chat is unknown.
+func (s *Store) ChatEphemeralExpiration(ctx context.Context, chatID string) (uint32, error) {
+	var expiration int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT ephemeral_expiration FROM wa_bridge.chats WHERE chat_id = $1`,
+		chatID).Scan(&expiration)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return uint32(expiration), err
+}
+
 // GroupChatsWithoutName returns the chat_ids of all group chats that have no
 // name set. Used on startup to drain groups created while the bridge was offline.
 func (s *Store) GroupChatsWithoutName(ctx context.Context) ([]string, error) {
@@ -315,6 +597,68 @@ func (s *Store) ApplyMessageEdit(ctx context.Context, messageID, chatID, newCont
 	return err
 }
 
+// RevokeMessage marks a message as deleted for everyone. The current content
+// is appended to edit_history with the revocation time and then cleared, so
+// the original text survives only in the audit trail. Reports whether a
+// stored message was updated.
+func (s *Store) RevokeMessage(ctx context.Context, messageID, chatID string, revokedAt time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx,
+		`UPDATE wa_bridge.messages
+		 SET
+		   edit_history = COALESCE(edit_history, '[]'::jsonb) || jsonb_build_array(jsonb_build_object(
+		     'content', content,
+		     'edited_at', COALESCE(edited_at, timestamp),
+		     'revoked_at', $3::timestamp
+		   )),
+		   content = NULL,
+		   is_revoked = true,
+		   revoked_at = $3
+		 WHERE message_id = $1 AND chat_id = $2 AND NOT is_revoked`,
+		messageID, chatID, revokedAt)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// receiptSetClause advances delivery_status ($3) monotonically along
+// sent -> delivered -> read -> played and stamps the matching *_at columns
+// with $4. Shared by wa_bridge.messages and wa_bridge.outgoing_messages.
+const receiptSetClause = `
+		 SET
+		   delivery_status = CASE
+		     WHEN array_position(ARRAY['sent', 'delivered', 'read', 'played'], $3::text)
+		        > COALESCE(array_position(ARRAY['sent', 'delivered', 'read', 'played'], delivery_status), 0)
+		     THEN $3::text ELSE delivery_status END,
+		   delivered_at = COALESCE(delivered_at, $4),
+		   read_at      = CASE WHEN $3 IN ('read', 'played') THEN COALESCE(read_at, $4) ELSE read_at END,
+		   played_at    = CASE WHEN $3 = 'played' THEN COALESCE(played_at, $4) ELSE played_at END`
+
+// ApplyReceipt advances the delivery state of the given messages in a chat and
+// of their outbox rows. status is one of "delivered", "read" or "played"; the
+// state never moves backwards and each timestamp keeps its first value.
+// A read or played receipt implies delivery, so earlier timestamps are filled
+// in when missing.
+func (s *Store) ApplyReceipt(ctx context.Context, chatID string, messageIDs []string, status string, ts time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE wa_bridge.messages`+receiptSetClause+`
+		 WHERE chat_id = $1 AND message_id = ANY($2)`,
+		chatID, pq.Array(messageIDs), status, ts)
+	if err != nil {
+		return fmt.Errorf("updating message receipts: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`UPDATE wa_bridge.outgoing_messages`+receiptSetClause+`
+		 WHERE chat_id = $1 AND sent_message_id = ANY($2)`,
+		chatID, pq.Array(messageIDs), status, ts)
+	if err != nil {
+		return fmt.Errorf("updating outbox receipts: %w", err)
+	}
+	return nil
+}
+
 // EnsureCustomer creates a customer record for the given phone number if one
 // does not already exist. It uses the push name as the customer name, falling
 // back to the phone number itself when push name is empty.
@@ -333,12 +677,16 @@ func (s *Store) EnsureCustomer(ctx context.Context, phoneNumber, pushName string
 	}
 }
 
-// BridgeCommand represents a row from wa_bridge.bridge_commands.
+// BridgeCommand represents a row from wa_bridge.bridge_commands. ChatID is
+// empty for create_group, which has no chat yet.
 type BridgeCommand struct {
 	ID          int64
 	CommandType string
 	ChatID      string
 	Payload     json.RawMessage
+	// Result holds the progress saved by an earlier run of a command that
+	// was requeued after a restart; nil otherwise.
+	Result json.RawMessage
 }
 
 // PendingCommandIDs returns the IDs of all pending bridge commands, ordered
@@ -370,8 +718,8 @@ func (s *Store) ClaimCommand(ctx context.Context, id int64) (*BridgeCommand, err
 		`UPDATE wa_bridge.bridge_commands
 		 SET status = 'processing', started_at = now()
 		 WHERE id = $1 AND status = 'pending'
-		 RETURNING id, command_type, chat_id, payload`,
-		id).Scan(&cmd.ID, &cmd.CommandType, &cmd.ChatID, &cmd.Payload)
+		 RETURNING id, command_type, COALESCE(chat_id, ''), payload, result`,
+		id).Scan(&cmd.ID, &cmd.CommandType, &cmd.ChatID, &cmd.Payload, &cmd.Result)
 	if err != nil {
 		return nil, err
 	}
@@ -388,6 +736,15 @@ func (s *Store) MarkCommandCompleted(ctx context.Context, id int64, result json.
 	return err
 }
 
+// UpdateCommandResult stores intermediate progress in a command's result
+// while it is still processing.
+func (s *Store) UpdateCommandResult(ctx context.Context, id int64, result json.RawMessage) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE wa_bridge.bridge_commands SET result = $1 WHERE id = $2`,
+		result, id)
+	return err
+}
+
 // MarkCommandFailed marks a bridge command as failed with an error message.
 func (s *Store) MarkCommandFailed(ctx context.Context, id int64, errMsg string) {
 	_, err := s.db.ExecContext(ctx,
@@ -403,11 +760,16 @@ func (s *Store) MarkCommandFailed(ctx context.Context, id int64, errMsg string)
 
 // ResetStaleProcessingCommands marks any commands stuck in 'processing' as
 // 'failed'. This recovers from crashes where the service died mid-processing
-// and the in-memory timeout was lost.
+// and the in-memory timeout was lost. backfill_chat commands are requeued as
+// 'pending' instead: they resume from the oldest stored message and the
+// progress kept in result.
 func (s *Store) ResetStaleProcessingCommands(ctx context.Context) (int64, error) {
 	result, err := s.db.ExecContext(ctx,
 		`UPDATE wa_bridge.bridge_commands
-		 SET status = 'failed', error_message = 'service restarted while processing', completed_at = now()
+		 SET status = CASE WHEN command_type = 'backfill_chat' THEN 'pending' ELSE 'failed' END,
+		     error_message = CASE WHEN command_type = 'backfill_chat' THEN error_message
+		                          ELSE 'service restarted while processing' END,
+		     completed_at = CASE WHEN command_type = 'backfill_chat' THEN NULL ELSE now() END
 		 WHERE status = 'processing'`)
 	if err != nil {
 		return 0, fmt.Errorf("resetting stale processing commands: %w", err)
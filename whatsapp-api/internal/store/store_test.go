@@ -0,0 +1,81 @@
+package store
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+)
+
+// testDB opens the database named by TEST_DATABASE_URL, skipping the test
+// when it is not set.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestReceiptSetClause(t *testing.T) {
+	db := testDB(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`CREATE TEMP TABLE receipts (
+		delivery_status text, delivered_at timestamptz, read_at timestamptz, played_at timestamptz)`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(`INSERT INTO receipts (delivery_status) VALUES ('sent')`); err != nil {
+		t.Fatal(err)
+	}
+
+	t0 := time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+	steps := []struct {
+		status    string
+		want      string
+		delivered bool
+		read      bool
+		played    bool
+	}{
+		{"delivered", "delivered", true, false, false},
+		{"read", "read", true, true, false},
+		{"delivered", "read", true, true, false}, // never moves backwards
+		{"played", "played", true, true, true},
+		{"read", "played", true, true, true},
+	}
+
+	for i, step := range steps {
+		ts := t0.Add(time.Duration(i) * time.Minute)
+		if _, err := tx.Exec(`UPDATE receipts`+receiptSetClause+`
+			 WHERE $1::text IS NOT NULL AND $2::text IS NOT NULL`, "", "", step.status, ts); err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+
+		var status string
+		var delivered, read, played sql.NullTime
+		if err := tx.QueryRow(`SELECT delivery_status, delivered_at, read_at, played_at FROM receipts`).
+			Scan(&status, &delivered, &read, &played); err != nil {
+			t.Fatal(err)
+		}
+		if status != step.want {
+			t.Errorf("step %d (%s): delivery_status = %s, want %s", i, step.status, status, step.want)
+		}
+		if delivered.Valid != step.delivered || read.Valid != step.read || played.Valid != step.played {
+			t.Errorf("step %d (%s): delivered/read/played set = %v/%v/%v, want %v/%v/%v", i, step.status,
+				delivered.Valid, read.Valid, played.Valid, step.delivered, step.read, step.played)
+		}
+		// Each timestamp keeps the first receipt's time.
+		if delivered.Valid && !delivered.Time.Equal(t0) {
+			t.Errorf("step %d: delivered_at = %s, want %s", i, delivered.Time, t0)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+package waclient
+
+import (
+	"context"
+
+	"go.mau.fi/whatsmeow"
+	"go.mau.fi/whatsmeow/types"
+)
+
+// ParticipantID returns the phone number of a group member, resolving LIDs
+// through the whatsmeow store when the phone number is not given.
+func ParticipantID(ctx context.Context, client *whatsmeow.Client, jid, phoneNumber types.JID) string {
+	if !phoneNumber.IsEmpty() {
+		return phoneNumber.User
+	}
+	jid = jid.ToNonAD()
+	if jid.Server == types.HiddenUserServer {
+		if pn, err := client.Store.LIDs.GetPNForLID(ctx, jid); err == nil && !pn.IsEmpty() {
+			return pn.User
+		}
+	}
+	return jid.User
+}
@@ -0,0 +1,37 @@
+// Package wamsg decodes WhatsApp message content shared by live messages
+// (messaging) and history syncs (commands).
+package wamsg
+
+import (
+	"go.mau.fi/whatsmeow/proto/waE2E"
+
+	"whatsapp-bridge/internal/store"
+)
+
+// PollCreation returns the poll creation content of m, whichever of the
+// versioned fields WhatsApp used, or nil if m is not a poll.
+func PollCreation(m *waE2E.Message) *waE2E.PollCreationMessage {
+	switch {
+	case m.PollCreationMessage != nil:
+		return m.PollCreationMessage
+	case m.PollCreationMessageV2 != nil:
+		return m.PollCreationMessageV2
+	case m.PollCreationMessageV3 != nil:
+		return m.PollCreationMessageV3
+	default:
+		return m.PollCreationMessageV5
+	}
+}
+
+// Poll converts a poll creation message to a store.Poll.
+func Poll(pc *waE2E.PollCreationMessage) *store.Poll {
+	options := make([]string, 0, len(pc.GetOptions()))
+	for _, o := range pc.GetOptions() {
+		options = append(options, o.GetOptionName())
+	}
+	return &store.Poll{
+		Name:            pc.GetName(),
+		Options:         options,
+		SelectableCount: int(pc.GetSelectableOptionsCount()),
+	}
+}
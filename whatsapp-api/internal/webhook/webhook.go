@@ -2,6 +2,7 @@
 package webhook
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
@@ -52,18 +53,9 @@ func SendText(webhookURL string, payload store.MessagePayload) {
 	}
 }
 
-// SendImage uploads imageData as a multipart/form-data POST to imageWebhookURL.
+// SendImage streams image as a multipart/form-data POST to imageWebhookURL.
 // The filename is derived from mimeType; mimeType is used as the part Content-Type.
-func SendImage(imageWebhookURL, senderID, senderName, chatID, messageID string, isGroup bool, imageData []byte, mimeType string) {
-	var body bytes.Buffer
-	writer := multipart.NewWriter(&body)
-
-	writer.WriteField("sender_id", senderID)
-	writer.WriteField("sender_name", senderName)
-	writer.WriteField("chat_id", chatID)
-	writer.WriteField("message_id", messageID)
-	writer.WriteField("is_group", strconv.FormatBool(isGroup))
-
+func SendImage(imageWebhookURL, senderID, senderName, chatID, messageID string, isGroup bool, image io.Reader, mimeType string) {
 	var filename string
 	switch mimeType {
 	case "image/jpeg":
@@ -78,22 +70,8 @@ func SendImage(imageWebhookURL, senderID, senderName, chatID, messageID string,
 		filename = "file.bin"
 	}
 
-	partHeader := make(textproto.MIMEHeader)
-	partHeader.Set("Content-Disposition", fmt.Sprintf(`form-data; name="data"; filename="%s"`, filename))
-	partHeader.Set("Content-Type", mimeType)
-	part, err := writer.CreatePart(partHeader)
-	if err != nil {
-		log.Error().Err(err).Str("message_id", messageID).Msg("failed to create multipart part")
-		return
-	}
-	if _, err := io.Copy(part, bytes.NewReader(imageData)); err != nil {
-		log.Error().Err(err).Str("message_id", messageID).Msg("failed to write image data")
-		return
-	}
-	writer.Close()
-
 	start := time.Now()
-	resp, err := http.Post(imageWebhookURL, writer.FormDataContentType(), &body)
+	resp, err := postFile(imageWebhookURL, senderID, senderName, chatID, messageID, isGroup, filename, mimeType, image)
 	metrics.WebhookDuration.WithLabelValues("image").Observe(time.Since(start).Seconds())
 	if err != nil {
 		log.Error().Err(err).Str("message_id", messageID).Msg("failed to send to image webhook")
@@ -117,42 +95,20 @@ func SendImage(imageWebhookURL, senderID, senderName, chatID, messageID string,
 	}
 }
 
-// SendVoice uploads audioData as a multipart/form-data POST to voiceWebhookURL.
+// SendVoice streams audio as a multipart/form-data POST to voiceWebhookURL.
 // It sniffs the audio container format to choose the correct filename and
 // Content-Type.
-func SendVoice(voiceWebhookURL, senderID, senderName, chatID, messageID string, isGroup bool, audioData []byte) {
-	var body bytes.Buffer
-	writer := multipart.NewWriter(&body)
-
-	writer.WriteField("sender_id", senderID)
-	writer.WriteField("sender_name", senderName)
-	writer.WriteField("chat_id", chatID)
-	writer.WriteField("message_id", messageID)
-	writer.WriteField("is_group", strconv.FormatBool(isGroup))
-
+func SendVoice(voiceWebhookURL, senderID, senderName, chatID, messageID string, isGroup bool, audio io.Reader) {
+	br := bufio.NewReader(audio)
 	filename := "file.opus"
 	contentType := "audio/opus"
-	if len(audioData) >= 4 && string(audioData[:4]) == "OggS" {
+	if magic, _ := br.Peek(4); string(magic) == "OggS" {
 		filename = "file.oga"
 		contentType = "audio/ogg"
 	}
 
-	partHeader := make(textproto.MIMEHeader)
-	partHeader.Set("Content-Disposition", fmt.Sprintf(`form-data; name="data"; filename="%s"`, filename))
-	partHeader.Set("Content-Type", contentType)
-	part, err := writer.CreatePart(partHeader)
-	if err != nil {
-		log.Error().Err(err).Str("message_id", messageID).Msg("failed to create multipart part")
-		return
-	}
-	if _, err := io.Copy(part, bytes.NewReader(audioData)); err != nil {
-		log.Error().Err(err).Str("message_id", messageID).Msg("failed to write audio data")
-		return
-	}
-	writer.Close()
-
 	start := time.Now()
-	resp, err := http.Post(voiceWebhookURL, writer.FormDataContentType(), &body)
+	resp, err := postFile(voiceWebhookURL, senderID, senderName, chatID, messageID, isGroup, filename, contentType, br)
 	metrics.WebhookDuration.WithLabelValues("voice").Observe(time.Since(start).Seconds())
 	if err != nil {
 		log.Error().Err(err).Str("message_id", messageID).Msg("failed to send to voice webhook")
@@ -175,3 +131,37 @@ func SendVoice(voiceWebhookURL, senderID, senderName, chatID, messageID string,
 			Msg("voice webhook returned non-2xx status")
 	}
 }
+
+// postFile POSTs the message fields and file as multipart/form-data, writing
+// the body through a pipe so the file is never held in memory.
+func postFile(webhookURL, senderID, senderName, chatID, messageID string, isGroup bool, filename, contentType string, file io.Reader) (*http.Response, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		writer.WriteField("sender_id", senderID)
+		writer.WriteField("sender_name", senderName)
+		writer.WriteField("chat_id", chatID)
+		writer.WriteField("message_id", messageID)
+		writer.WriteField("is_group", strconv.FormatBool(isGroup))
+
+		partHeader := make(textproto.MIMEHeader)
+		partHeader.Set("Content-Disposition", fmt.Sprintf(`form-data; name="data"; filename="%s"`, filename))
+		partHeader.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(partHeader)
+		if err != nil {
+			pw.CloseWithError(fmt.Errorf("creating multipart part: %w", err))
+			return
+		}
+		if _, err := io.Copy(part, file); err != nil {
+			pw.CloseWithError(fmt.Errorf("writing file data: %w", err))
+			return
+		}
+		pw.CloseWithError(writer.Close())
+	}()
+
+	resp, err := http.Post(webhookURL, writer.FormDataContentType(), pr)
+	// Unblock the writer if the request ended before reading the whole body.
+	pr.Close()
+	return resp, err
+}
@@ -11,9 +11,11 @@ import (
 	"whatsapp-bridge/internal/commands"
 	"whatsapp-bridge/internal/config"
 	"whatsapp-bridge/internal/logging"
+	"whatsapp-bridge/internal/media"
 	"whatsapp-bridge/internal/messaging"
 	"whatsapp-bridge/internal/metrics"
 	"whatsapp-bridge/internal/outbox"
+	"whatsapp-bridge/internal/retention"
 	"whatsapp-bridge/internal/server"
 	"whatsapp-bridge/internal/store"
 	"whatsapp-bridge/internal/waclient"
@@ -30,18 +32,28 @@ func main() {
 	db := store.New(cfg.DatabaseURL)
 	defer db.Close()
 
+	storage, err := media.NewStorage(cfg)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to set up media storage")
+	}
+
 	qrStore := &waclient.QRStore{}
 	client := waclient.New(ctx, cfg.DatabaseURL)
 
+	pipeline := media.NewPipeline(client, db, cfg, storage)
 	agentHandler := agent.NewHandler(db, client)
-	cmdListener := commands.New(client, db, cfg.DatabaseURL)
-	messaging.RegisterHandler(client, cfg, db, agentHandler, cmdListener)
-	server.Start(ctx, client, qrStore, db, agentHandler, cfg.ListenAddr)
+	cmdListener := commands.New(client, db, cfg, pipeline)
+	outboxListener := outbox.New(client, db, cfg, storage)
+	messaging.RegisterHandler(client, cfg, db, pipeline, agentHandler, cmdListener)
+	server.Start(ctx, client, qrStore, db, storage, agentHandler, cmdListener, cfg.ListenAddr)
 	go waclient.Connect(ctx, client, qrStore)
-	go outbox.Listen(ctx, client, db, cfg.DatabaseURL)
+	go outboxListener.Listen(ctx)
 	go messaging.ListenGroupChats(ctx, client, db, cfg.DatabaseURL)
 	go agentHandler.Listen(ctx, cfg.DatabaseURL)
 	go cmdListener.Listen(ctx)
+	if storage != nil && len(cfg.MediaRetention) > 0 {
+		go retention.New(db, storage, cfg).Run(ctx)
+	}
 	go func() {
 		ticker := time.NewTicker(15 * time.Second)
 		defer ticker.Stop()